@@ -0,0 +1,130 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Aggregate and window functions implemented in Go. Every group
+// (or window) gets a fresh Aggregate from the factory passed to
+// RegisterAggregate() or RegisterWindow(), so state can simply live in the Aggregate
+// value itself. Arguments are typed as described for results in
+// the package documentation, results are converted just like
+// parameters for Execute().
+
+import (
+	"os";
+	"unsafe";
+)
+
+// An aggregate SQL function. Step() is called for each row in
+// the group, Final() once at the end to get the result.
+type Aggregate interface {
+	Step(args []interface{}) os.Error;
+	Final() (interface{}, os.Error);
+}
+
+// An aggregate that can also be used as a window function, see
+// http://www.sqlite.org/windowfunctions.html for details. Value()
+// returns the result for the current window without finishing
+// the aggregate, Inverse() removes a row Step() added earlier.
+type WindowAggregate interface {
+	Aggregate;
+	Value() (interface{}, os.Error);
+	Inverse(args []interface{}) os.Error;
+}
+
+// A Go aggregate registered with SQLite.
+type aggregate struct {
+	connection	*Connection;
+	factory		func() Aggregate;
+}
+
+// Make the Aggregates returned by factory available as an SQL
+// aggregate function called name, taking nargs arguments (-1 for
+// any number). Set deterministic as for RegisterFunc().
+func (self *Connection) RegisterAggregate(name string, nargs int, factory func() Aggregate, deterministic bool) os.Error {
+	return self.registerAggregate(name, nargs, factory, deterministic, false)
+}
+
+// Like RegisterAggregate(), but the function can be used as a
+// window function as well.
+func (self *Connection) RegisterWindow(name string, nargs int, factory func() WindowAggregate, deterministic bool) os.Error {
+	f := func() Aggregate { return factory() };
+	return self.registerAggregate(name, nargs, f, deterministic, true);
+}
+
+func (self *Connection) registerAggregate(name string, nargs int, factory func() Aggregate, deterministic, window bool) (error os.Error) {
+	a := new(aggregate);
+	a.connection = self;
+	a.factory = factory;
+
+	flags := sqlUTF8;
+	if deterministic {
+		flags |= sqlDeterministic
+	}
+
+	// SQLite unregisters the handle if this fails
+	rc := self.handle.sqlCreateAggregate(name, nargs, flags, register(a), window);
+	if rc != StatusOk {
+		error = self.error()
+	}
+	return;
+}
+
+// The Aggregate for the group whose state SQLite keeps in slot;
+// we make one if there's none yet. A nil slot means SQLite has
+// no state for us, so we return a throwaway Aggregate.
+func (self *aggregate) instance(slot *unsafe.Pointer) Aggregate {
+	if slot != nil && *slot != nil {
+		return lookup(*slot).(Aggregate)
+	}
+	a := self.factory();
+	if slot != nil {
+		*slot = register(a)
+	}
+	return a;
+}
+
+// Unregister the Aggregate kept in slot, if any.
+func (self *aggregate) release(slot *unsafe.Pointer) {
+	if slot != nil && *slot != nil {
+		unregister(*slot);
+		*slot = nil;
+	}
+}
+
+func (self *aggregate) step(ctx *sqlContext, slot *unsafe.Pointer, values []sqlValue, inverse bool) {
+	args := make([]interface{}, len(values));
+	for i := range values {
+		args[i] = values[i].value()
+	}
+
+	a := self.instance(slot);
+	var error os.Error;
+	if inverse {
+		error = a.(WindowAggregate).Inverse(args)
+	} else {
+		error = a.Step(args)
+	}
+	if error != nil {
+		ctx.sqlResultError(error.String())
+	}
+}
+
+func (self *aggregate) final(ctx *sqlContext, slot *unsafe.Pointer, final bool) {
+	a := self.instance(slot);
+	var value interface{};
+	var error os.Error;
+	if final {
+		// SQLite is done with this group
+		defer self.release(slot);
+		value, error = a.Final();
+	} else {
+		value, error = a.(WindowAggregate).Value()
+	}
+	if error != nil {
+		ctx.sqlResultError(error.String());
+		return;
+	}
+	ctx.result(self.connection, value);
+}
@@ -0,0 +1,145 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Authorizers, see http://www.sqlite.org/c3ref/set_authorizer.html
+// for details. SQLite asks the authorizer about every action a
+// statement would take while preparing it, so a denied statement
+// never runs at all; Prepare() fails with a SystemError whose
+// Basic() code is StatusAuth instead.
+
+import (
+	"os";
+	"strings";
+	"unsafe";
+)
+
+// Decide whether a statement may take an action (ActionRead and
+// friends) and return AuthAllow, AuthDeny or AuthIgnore. The
+// meaning of arg1 and arg2 depends on the action, see the
+// constants; database is the database ("main", "temp" or an
+// attached name) and trigger the innermost trigger or view the
+// action comes from, either may be "". Like a BusyHandler, an
+// Authorizer must not use the connection.
+type Authorizer func(action int, arg1, arg2, database, trigger string) int
+
+// Check all statements prepared from now on with authorizer, a
+// nil authorizer allows everything again. Statements prepared
+// earlier are not checked again, except for those in the
+// statement cache, which we drop.
+func (self *Connection) SetAuthorizer(authorizer Authorizer) (error os.Error) {
+	var handle unsafe.Pointer;
+	if authorizer != nil {
+		handle = register(authorizer)
+	}
+
+	rc := self.handle.sqlSetAuthorizer(handle);
+	if rc != StatusOk {
+		error = self.error();
+		if handle != nil {
+			unregister(handle)
+		}
+		return;
+	}
+
+	self.setCallback("authorizer", handle);
+	self.cache.flush();
+	return;
+}
+
+// Pragmas that only read, whatever their argument.
+var readPragmas = map[string]bool{
+	"table_info": true,
+	"table_xinfo": true,
+	"index_list": true,
+	"index_info": true,
+	"index_xinfo": true,
+	"foreign_key_list": true,
+	"foreign_key_check": true,
+	"integrity_check": true,
+	"quick_check": true,
+}
+
+// Pragmas that only read when called without an argument. Some
+// pragmas without an argument write (incremental_vacuum,
+// wal_checkpoint, optimize), so we can't just allow all of them.
+var queryPragmas = map[string]bool{
+	"application_id": true,
+	"auto_vacuum": true,
+	"cache_size": true,
+	"collation_list": true,
+	"compile_options": true,
+	"data_version": true,
+	"database_list": true,
+	"encoding": true,
+	"foreign_keys": true,
+	"freelist_count": true,
+	"function_list": true,
+	"journal_mode": true,
+	"module_list": true,
+	"page_count": true,
+	"page_size": true,
+	"pragma_list": true,
+	"query_only": true,
+	"schema_version": true,
+	"synchronous": true,
+	"table_list": true,
+	"user_version": true,
+}
+
+// Built-in functions (some only in extensions) that do more than
+// compute a value: load code, touch files or change tokenizers.
+var unsafeFunctions = map[string]bool{
+	"load_extension": true,
+	"fts3_tokenizer": true,
+	"readfile": true,
+	"writefile": true,
+	"edit": true,
+}
+
+// An Authorizer for untrusted queries: SELECT (including WITH
+// RECURSIVE), SQL functions, transactions and reading pragmas are
+// allowed, anything that changes data or schema, ATTACH, DETACH,
+// setting pragmas and functions like load_extension() is denied.
+// If tables are given, only those tables (and views) can be read,
+// case-insensitively; otherwise all of them can.
+//
+// There are gaps: functions registered with RegisterFunc() and
+// friends are allowed, so don't register any with side effects on
+// connections running untrusted queries. And SQLite doesn't tell
+// the authorizer what kind of BEGIN it's looking at, so BEGIN
+// IMMEDIATE and BEGIN EXCLUSIVE get through and take write locks,
+// even though nothing can be written.
+func ReadOnlyPolicy(tables ...string) Authorizer {
+	allowed := make(map[string]bool);
+	for _, t := range tables {
+		allowed[strings.ToLower(t)] = true
+	}
+
+	return func(action int, arg1, arg2, database, trigger string) int {
+		switch action {
+		case ActionSelect, ActionRecursive, ActionTransaction, ActionSavepoint:
+			return AuthAllow
+		case ActionFunction:
+			if !unsafeFunctions[strings.ToLower(arg2)] {
+				return AuthAllow
+			}
+		case ActionRead:
+			if len(allowed) == 0 || allowed[strings.ToLower(arg1)] {
+				return AuthAllow
+			}
+			// reads from inside an allowed view are fine
+			if len(trigger) > 0 && allowed[strings.ToLower(trigger)] {
+				return AuthAllow
+			}
+		case ActionPragma:
+			pragma := strings.ToLower(arg1);
+			if readPragmas[pragma] || len(arg2) == 0 && queryPragmas[pragma] {
+				return AuthAllow
+			}
+		}
+		return AuthDeny;
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Online backups, see http://www.sqlite.org/backup.html for
+// details. A backup copies a database page by page while the
+// source stays usable; if the source is changed through another
+// connection in the middle of a backup, the backup starts over
+// automatically.
+
+import (
+	"os";
+	"time";
+)
+
+// A backup in progress. Neither connection should be closed
+// before the backup is finished, and the destination shouldn't
+// be used at all in the meantime.
+type Backup struct {
+	handle		*sqlBackup;
+	source		*Connection;
+	destination	*Connection;
+}
+
+// Start copying database srcDB ("main", "temp" or an attached
+// name) of this connection over database destDB of dest.
+func (self *Connection) Backup(dest *Connection, srcDB, destDB string) (backup *Backup, error os.Error) {
+	b := new(Backup);
+	b.source = self;
+	b.destination = dest;
+	b.handle = dest.handle.sqlBackupInit(destDB, self.handle, srcDB);
+	if b.handle == nil {
+		error = dest.error();
+		return;
+	}
+	backup = b;
+	return;
+}
+
+// Error for status codes returned by sqlite3_backup_*(), which
+// doesn't always leave them in a connection.
+func backupError(rc int) os.Error {
+	return &SystemError{sqlErrorString(rc), rc & 0xff, rc}
+}
+
+// Copy up to pages pages, all remaining pages if pages is
+// negative. We're done once everything has been copied. Errors
+// with StatusBusy or StatusLocked are temporary, Step() can be
+// called again later; anything else is fatal and the backup can
+// only be finished.
+func (self *Backup) Step(pages int) (done bool, error os.Error) {
+	if self.handle == nil {
+		error = &DriverError{"Step: Backup finished!"};
+		return;
+	}
+
+	rc := self.handle.sqlStep(pages);
+	switch rc & 0xff {
+	case StatusDone:
+		done = true;
+	case StatusOk:
+	default:
+		error = backupError(rc);
+	}
+	return;
+}
+
+// Number of pages still to be copied as of the last Step().
+func (self *Backup) Remaining() int {
+	if self.handle == nil {
+		return 0
+	}
+	return self.handle.sqlRemaining();
+}
+
+// Number of pages in the source database as of the last Step().
+func (self *Backup) PageCount() int {
+	if self.handle == nil {
+		return 0
+	}
+	return self.handle.sqlPageCount();
+}
+
+// Free all associated resources, whether the backup is done or
+// not. Reports the fatal error that ended the backup, if any.
+func (self *Backup) Finish() (error os.Error) {
+	if self.handle == nil {
+		return
+	}
+
+	rc := self.handle.sqlFinish();
+	if rc != StatusOk {
+		error = backupError(rc)
+	}
+	self.handle = nil;
+	self.source = nil;
+	self.destination = nil;
+	return;
+}
+
+// How many times in a row Run() retries a step that failed with
+// a temporary error before giving up.
+const backupRetries = 100
+
+// Run the whole backup, copying pages pages at a time (all of
+// them at once if pages is negative) and sleeping pause
+// nanoseconds between steps so other connections get a chance to
+// write to the source. Temporary errors just make us try again
+// after the pause, but only so often in a row. Finishes the
+// backup in any case.
+func (self *Backup) Run(pages int, pause int64) (error os.Error) {
+	if pages == 0 {
+		error = &DriverError{"Run: Need to copy at least one page per step!"};
+		_ = self.Finish();
+		return;
+	}
+
+	retries := 0;
+	for {
+		var done bool;
+		done, error = self.Step(pages);
+		if done {
+			break
+		}
+		if error != nil {
+			se, ok := error.(*SystemError);
+			if !ok || (se.Basic() != StatusBusy && se.Basic() != StatusLocked) {
+				break
+			}
+			retries++;
+			if retries > backupRetries {
+				break
+			}
+			error = nil;
+		} else {
+			retries = 0
+		}
+		if pause > 0 {
+			time.Sleep(pause)
+		}
+	}
+
+	e := self.Finish();
+	if error == nil {
+		error = e
+	}
+	return;
+}
@@ -0,0 +1,272 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"fmt";
+	"os";
+	"reflect";
+	"time";
+)
+
+// Default layout used to bind time values, see SetTimeFormat().
+// SQLite's own date and time functions understand this format.
+const DefaultTimeFormat = "2006-01-02 15:04:05"
+
+// Change the layout (as understood by time.Format()) used to bind
+// time.Time values on this connection. An empty layout binds times
+// as integer seconds since the Unix epoch instead.
+func (self *Connection) SetTimeFormat(layout string) {
+	self.timeFormat = layout
+}
+
+func (self *Connection) timeValue(t *time.Time) interface{} {
+	if len(self.timeFormat) == 0 {
+		return t.Seconds()
+	}
+	return t.Format(self.timeFormat);
+}
+
+// A slice of values bound to a single parameter for carray() to
+// pick up (see tablefunc.go), made with List(). Bare slices other
+// than []byte are rejected, since SQL would only see NULL.
+type ValueList struct {
+	values interface{};
+}
+
+// Wrap a slice (say []int64 or []string) so it binds as a list.
+func List(values interface{}) ValueList	{ return ValueList{values} }
+
+// Reduce a Go value to one of the types SQLite can store natively:
+// int64, float64, string, []byte or nil. Booleans become 0 or 1,
+// times are formatted according to SetTimeFormat(). A ValueList
+// becomes []interface{} of native values, which we bind as a single
+// pointer. We try a type switch first since it covers the common
+// cases cheaply, and only fall back to reflection for named and
+// odd-sized types.
+func (self *Connection) native(value interface{}) (result interface{}, error os.Error) {
+	switch v := value.(type) {
+	case nil:
+		return;
+	case int64, float64, string:
+		result = v;
+		return;
+	case []byte:
+		// a nil slice is as close to NULL as we get
+		if v != nil {
+			result = v
+		}
+		return;
+	case int:
+		result = int64(v);
+		return;
+	case bool:
+		if v {
+			result = int64(1)
+		} else {
+			result = int64(0)
+		}
+		return;
+	case *time.Time:
+		if v != nil {
+			result = self.timeValue(v)
+		}
+		return;
+	case time.Time:
+		result = self.timeValue(&v);
+		return;
+	case ValueList:
+		r := reflect.ValueOf(v.values);
+		if r.Kind() != reflect.Slice {
+			error = &DriverError{fmt.Sprintf("Execute: Can't bind %T as a list!", v.values)};
+			return;
+		}
+		result, error = self.nativeList(r);
+		return;
+	}
+
+	r := reflect.ValueOf(value);
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		result = r.Int();
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := r.Uint();
+		if u > 1<<63-1 {
+			error = &DriverError{fmt.Sprintf("Execute: %d doesn't fit into 64-bit integer!", u)};
+			return;
+		}
+		result = int64(u);
+	case reflect.Float32, reflect.Float64:
+		result = r.Float();
+	case reflect.String:
+		result = r.String();
+	case reflect.Bool:
+		result, error = self.native(r.Bool());
+	case reflect.Ptr:
+		if !r.IsNil() {
+			result, error = self.native(r.Elem().Interface())
+		}
+	case reflect.Slice:
+		if r.Type().Elem().Kind() != reflect.Uint8 {
+			error = &DriverError{fmt.Sprintf("Execute: Can't bind value of type %T, use List()!", value)};
+			return;
+		}
+		result, error = self.native(r.Bytes());
+	default:
+		error = &DriverError{fmt.Sprintf("Execute: Can't bind value of type %T!", value)};
+	}
+	return;
+}
+
+func (self *Connection) nativeList(r reflect.Value) (result interface{}, error os.Error) {
+	list := make([]interface{}, r.Len());
+	for i := range list {
+		list[i], error = self.native(r.Index(i).Interface());
+		if error != nil {
+			return
+		}
+		if _, ok := list[i].([]interface{}); ok {
+			error = &DriverError{"Execute: Can't bind nested lists!"};
+			return;
+		}
+	}
+	result = list;
+	return;
+}
+
+// Bind a single parameter to the given slot (counting from 0),
+// picking the sqlite3_bind_*() function that matches the value.
+func (self *Statement) bind(slot int, value interface{}) (error os.Error) {
+	var v interface{};
+	v, error = self.connection.native(value);
+	if error != nil {
+		return
+	}
+
+	var rc int;
+	switch v := v.(type) {
+	case nil:
+		rc = self.handle.sqlBindNull(slot);
+	case int64:
+		rc = self.handle.sqlBindInt64(slot, v);
+	case float64:
+		rc = self.handle.sqlBindDouble(slot, v);
+	case string:
+		rc = self.handle.sqlBindText(slot, v);
+	case []byte:
+		rc = self.handle.sqlBindBlob(slot, v);
+	case []interface{}:
+		// SQLite releases the handle, even if this fails
+		rc = self.handle.sqlBindPointer(slot, register(v));
+	}
+
+	if rc != StatusOk {
+		error = self.connection.error()
+	}
+	return;
+}
+
+// Bind all parameters for an execution. A single map or struct
+// argument binds the statement's named parameters by name (see
+// bindNamed()), anything else binds parameters by position.
+func (self *Statement) bindAll(parameters []interface{}) (error os.Error) {
+	if len(parameters) == 1 {
+		if r, ok := namedSource(parameters[0]); ok {
+			return self.bindNamed(r)
+		}
+	}
+
+	if len(parameters) != self.handle.sqlBindParameterCount() {
+		error = &DriverError{"Execute: Number of parameters doesn't match!"};
+		return;
+	}
+
+	for k, v := range parameters {
+		error = self.bind(k, v);
+		if error != nil {
+			return
+		}
+	}
+	return;
+}
+
+// Can we bind parameters by name from the given value? We take
+// maps with string keys and structs (or pointers to them), time
+// values and lists excepted since those are bound as values.
+func namedSource(value interface{}) (r reflect.Value, ok bool) {
+	switch value.(type) {
+	case time.Time, *time.Time, ValueList, *ValueList:
+		return
+	}
+
+	r = reflect.ValueOf(value);
+	if r.Kind() == reflect.Ptr && !r.IsNil() && r.Elem().Kind() == reflect.Struct {
+		r = r.Elem()
+	}
+
+	switch r.Kind() {
+	case reflect.Map:
+		ok = r.Type().Key() == reflect.TypeOf("");
+	case reflect.Struct:
+		ok = true;
+	}
+	return;
+}
+
+// Bind each named parameter (":name", "@name" or "$name") to the
+// map entry or struct field of the same name, the prefix removed.
+// Map keys may include the prefix as well. Every parameter must
+// have a value, and anonymous "?" parameters can't be bound this
+// way at all.
+func (self *Statement) bindNamed(r reflect.Value) (error os.Error) {
+	n := self.handle.sqlBindParameterCount();
+	for i := 0; i < n; i++ {
+		name := self.handle.sqlBindParameterName(i);
+		if len(name) == 0 {
+			error = &DriverError{fmt.Sprintf("Execute: Parameter %d has no name!", i+1)};
+			return;
+		}
+
+		value, found := namedValue(r, name);
+		if !found {
+			error = &DriverError{fmt.Sprintf("Execute: No value for parameter %s!", name)};
+			return;
+		}
+
+		error = self.bind(i, value);
+		if error != nil {
+			return
+		}
+	}
+	return;
+}
+
+func namedValue(r reflect.Value, name string) (value interface{}, found bool) {
+	key := name[1:];
+
+	switch r.Kind() {
+	case reflect.Map:
+		for _, k := range []string{key, name} {
+			v := r.MapIndex(reflect.ValueOf(k));
+			if v.IsValid() {
+				return v.Interface(), true
+			}
+		}
+	case reflect.Struct:
+		for _, f := range fields(r.Type()) {
+			if f.name != key {
+				continue
+			}
+			found = true;
+			// a nil embedded struct pointer means the
+			// field doesn't exist, so we bind NULL
+			if v, ok := fieldByIndex(r, f.index, false); ok {
+				value = v.Interface()
+			}
+			return;
+		}
+	}
+	return;
+}
@@ -0,0 +1,145 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Incremental I/O on BLOBs, see http://www.sqlite.org/c3ref/blob.html
+// for details. A Blob can neither grow nor shrink, use zeroblob()
+// in SQL to make room for data before writing it.
+
+import (
+	"fmt";
+	"os";
+)
+
+// A single BLOB opened for incremental I/O. Implements the
+// io.ReaderAt, io.WriterAt and io.Closer interfaces.
+type Blob struct {
+	handle		*sqlBlob;
+	connection	*Connection;
+	size		int64;
+}
+
+// Open the BLOB in the given column and row (by rowid) of a
+// table in database ("main" unless something was attached).
+func (self *Connection) OpenBlob(database, table, column string, row int64, writable bool) (blob *Blob, error os.Error) {
+	b := new(Blob);
+	b.connection = self;
+	var rc int;
+	b.handle, rc = self.handle.sqlBlobOpen(database, table, column, row, writable);
+	if rc != StatusOk {
+		error = self.error();
+		return;
+	}
+
+	b.size = int64(b.handle.sqlBytes());
+	blob = b;
+	return;
+}
+
+// Size of the BLOB in bytes.
+func (self *Blob) Size() int64	{ return self.size }
+
+// Check that we can transfer n bytes at offset, returning how
+// many bytes we can transfer.
+func (self *Blob) fit(where string, n int, offset int64) (m int, error os.Error) {
+	if self.handle == nil {
+		error = &DriverError{where + ": Blob closed!"};
+		return;
+	}
+	if offset < 0 {
+		error = &DriverError{fmt.Sprintf("%s: Negative offset %d!", where, offset)};
+		return;
+	}
+	m = n;
+	if int64(m) > self.size-offset {
+		m = int(self.size - offset);
+		if m < 0 {
+			m = 0
+		}
+	}
+	return;
+}
+
+// Read len(data) bytes starting at offset. Like any ReaderAt,
+// we return os.EOF if we read less than that because we hit
+// the end of the BLOB.
+func (self *Blob) ReadAt(data []byte, offset int64) (n int, error os.Error) {
+	var m int;
+	m, error = self.fit("ReadAt", len(data), offset);
+	if error != nil {
+		return
+	}
+
+	rc := self.handle.sqlRead(data[0:m], int(offset));
+	if rc != StatusOk {
+		error = self.connection.error();
+		return;
+	}
+
+	n = m;
+	if n < len(data) {
+		error = os.EOF
+	}
+	return;
+}
+
+// Write data starting at offset. Since BLOBs can't grow we fail
+// (and write nothing) if data doesn't fit.
+func (self *Blob) WriteAt(data []byte, offset int64) (n int, error os.Error) {
+	var m int;
+	m, error = self.fit("WriteAt", len(data), offset);
+	if error != nil {
+		return
+	}
+	if m < len(data) {
+		error = &DriverError{"WriteAt: Can't write past end of blob!"};
+		return;
+	}
+
+	rc := self.handle.sqlWrite(data, int(offset));
+	if rc != StatusOk {
+		error = self.connection.error();
+		return;
+	}
+
+	n = m;
+	return;
+}
+
+// Move to the BLOB in another row of the same table and column,
+// which is a lot cheaper than opening a new Blob. If this fails,
+// the Blob can only be closed.
+func (self *Blob) Reopen(row int64) (error os.Error) {
+	if self.handle == nil {
+		error = &DriverError{"Reopen: Blob closed!"};
+		return;
+	}
+
+	rc := self.handle.sqlReopen(row);
+	if rc != StatusOk {
+		error = self.connection.error();
+		self.size = 0;
+		return;
+	}
+
+	self.size = int64(self.handle.sqlBytes());
+	return;
+}
+
+// Free all associated resources. Note that changes to
+// a writable BLOB may not be visible before this.
+func (self *Blob) Close() (error os.Error) {
+	if self.handle == nil {
+		return
+	}
+
+	rc := self.handle.sqlClose();
+	if rc != StatusOk {
+		error = self.connection.error()
+	}
+	self.handle = nil;
+	self.connection = nil;
+	return;
+}
@@ -0,0 +1,81 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"os";
+	"rand";
+	"time";
+	"unsafe";
+)
+
+// Called when SQLite finds the database locked. The count is
+// the number of times the handler was called for the same lock
+// already. Return true to try again, false to give up; in that
+// case the operation fails with StatusBusy. See SetBusyHandler().
+type BusyHandler func(count int) bool
+
+// Retry for up to the given number of milliseconds when the
+// database is locked, replacing any BusyHandler. A timeout of
+// 0 means we give up right away. Open() sets 16 seconds unless
+// the URL says otherwise, see BusyTimeoutURL().
+func (self *Connection) SetBusyTimeout(milliseconds int) (error os.Error) {
+	rc := self.handle.sqlBusyTimeout(milliseconds);
+	if rc != StatusOk {
+		error = self.error();
+		return;
+	}
+	// SQLite dropped our handler, if any
+	self.setCallback("busy", nil);
+	return;
+}
+
+// Let handler decide what to do when the database is locked,
+// replacing any busy timeout. A nil handler means we give up
+// right away. Note that the handler runs while SQLite is in the
+// middle of things, so it must not use the connection.
+func (self *Connection) SetBusyHandler(handler BusyHandler) (error os.Error) {
+	var handle unsafe.Pointer;
+	if handler != nil {
+		handle = register(handler)
+	}
+
+	rc := self.handle.sqlBusyHandler(handle);
+	if rc != StatusOk {
+		error = self.error();
+		if handle != nil {
+			unregister(handle)
+		}
+		return;
+	}
+
+	self.setCallback("busy", handle);
+	return;
+}
+
+// A BusyHandler that sleeps between attempts, starting at base
+// nanoseconds and doubling each time up to max, and that gives
+// up after the given number of retries. Each sleep is jittered
+// by up to half its length so competing connections don't keep
+// running into each other.
+func Backoff(base, max int64, retries int) BusyHandler {
+	return func(count int) bool {
+		if count >= retries {
+			return false
+		}
+		delay := base;
+		for i := 0; i < count && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		if delay > 1 {
+			delay -= rand.Int63n(delay/2 + 1)
+		}
+		time.Sleep(delay);
+		return true;
+	}
+}
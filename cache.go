@@ -0,0 +1,185 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Caching prepared statements. Instead of finalizing a statement
+// on Close(), we reset it and keep it around under the query it
+// was prepared from; the next Prepare() of the same query gets it
+// back without parsing anything. The cache holds idle statements
+// only: a statement handed out by Prepare() is not in the cache
+// until it is closed again, and a statement closed while one of
+// its result sets is still open only goes back once that result
+// set is done. Once the cache is full, the least recently used
+// statement is finalized.
+//
+// Statements only pass the authorizer when they're prepared, so
+// flush() starts a new generation and statements prepared in an
+// older one are finalized instead of going back into the cache.
+// Result sets fetch on their own goroutine (see set.go), so the
+// cache has a lock, which also covers the results and closed
+// fields of statements.
+
+import (
+	"container/list";
+	"sync";
+)
+
+// Number of idle statements a new connection keeps, see
+// SetStatementCacheSize().
+const DefaultStatementCacheSize = 16
+
+// How the statement cache is doing, see StatementCacheStats().
+type CacheStats struct {
+	Hits		int64;	// Prepare() calls served from the cache
+	Misses		int64;	// Prepare() calls that had to parse
+	Evictions	int64;	// statements finalized to make room
+	Size		int;	// idle statements in the cache
+	Capacity	int;
+}
+
+type statementCache struct {
+	lock		sync.Mutex;	// protects everything below
+	capacity	int;
+	generation	int64;	// bumped by flush()
+	lru		*list.List;	// of *cacheEntry, most recently used first
+	entries		map[string]*list.Element;
+	pending		map[*Statement]bool;	// closed but with open results
+	stats		CacheStats;
+}
+
+type cacheEntry struct {
+	query	string;
+	handle	*sqlStatement;
+}
+
+func newStatementCache(capacity int) *statementCache {
+	c := new(statementCache);
+	c.capacity = capacity;
+	c.lru = list.New();
+	c.entries = make(map[string]*list.Element);
+	c.pending = make(map[*Statement]bool);
+	return c;
+}
+
+// Keep at most n idle statements, finalizing the least recently
+// used ones if there are more already. A size of 0 turns the cache
+// off, statements are finalized on Close() (or once their results
+// are done) as usual.
+func (self *Connection) SetStatementCacheSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	c := self.cache;
+	c.lock.Lock();
+	defer c.lock.Unlock();
+	c.capacity = n;
+	c.evict();
+}
+
+// Counters and sizes for the statement cache.
+func (self *Connection) StatementCacheStats() (stats CacheStats) {
+	c := self.cache;
+	c.lock.Lock();
+	defer c.lock.Unlock();
+	stats = c.stats;
+	stats.Size = c.lru.Len();
+	stats.Capacity = c.capacity;
+	return;
+}
+
+// Take the idle statement for query out of the cache, nil if
+// there is none. Either way we return the current generation,
+// which a statement prepared afresh belongs to as well.
+func (self *statementCache) get(query string) (handle *sqlStatement, generation int64) {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	generation = self.generation;
+	if self.capacity == 0 {
+		return
+	}
+	e, ok := self.entries[query];
+	if !ok {
+		self.stats.Misses++;
+		return;
+	}
+	self.stats.Hits++;
+	self.remove(e);
+	handle = e.Value.(*cacheEntry).handle;
+	return;
+}
+
+// Put a statement (reset already) back into the cache. If it's
+// from an older generation, if we have one for the same query
+// already, or if the cache is off, we don't keep it and the
+// caller has to finalize it.
+func (self *statementCache) put(query string, handle *sqlStatement, generation int64) bool {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	if _, ok := self.entries[query]; ok || self.capacity == 0 || generation != self.generation {
+		return false
+	}
+	self.entries[query] = self.lru.PushFront(&cacheEntry{query, handle});
+	self.evict();
+	return true;
+}
+
+// The rest must be called with the lock held.
+
+func (self *statementCache) remove(e *list.Element) {
+	self.lru.Remove(e);
+	self.entries[e.Value.(*cacheEntry).query] = nil, false;
+}
+
+// Finalize statements until we're within capacity again.
+func (self *statementCache) evict() {
+	for self.lru.Len() > self.capacity {
+		e := self.lru.Back();
+		self.remove(e);
+		// the statement is idle, so finalizing it can only
+		// repeat an error we reported before
+		_ = e.Value.(*cacheEntry).handle.sqlFinalize();
+		self.stats.Evictions++;
+	}
+}
+
+// Finalize all idle statements and start a new generation.
+func (self *statementCache) drop() {
+	self.generation++;
+	for self.lru.Len() > 0 {
+		e := self.lru.Front();
+		self.remove(e);
+		_ = e.Value.(*cacheEntry).handle.sqlFinalize();
+	}
+}
+
+// Get rid of all statements prepared so far, say because they
+// were prepared under an authorizer that no longer applies. Idle
+// ones are finalized right away, those handed out or waiting for
+// their results once they're closed or done.
+func (self *statementCache) flush() {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	self.drop();
+}
+
+// Finalize everything, including statements still waiting for
+// their results, which are finished for good; only for
+// Connection.Close().
+func (self *statementCache) close() {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	self.drop();
+	for s := range self.pending {
+		if rs := s.results; rs != nil {
+			rs.more = false;
+			rs.unwatch();
+			s.results = nil;
+		}
+		_ = s.handle.sqlFinalize();
+		s.handle = nil;
+		s.connection = nil;
+	}
+	self.pending = make(map[*Statement]bool);
+}
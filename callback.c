@@ -0,0 +1,428 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Trampolines for callbacks from SQLite into Go, see the
+// comments in callback.go for details.
+
+#include <stdlib.h>
+#include <string.h>
+#include <sqlite3.h>
+#include "_cgo_export.h"
+
+static int wsq_busy_trampoline(void *handle, int count)
+{
+	return goBusyHandler(handle, count);
+}
+
+int wsq_busy_handler(sqlite3 *db, void *handle)
+{
+	if (handle == NULL) {
+		return sqlite3_busy_handler(db, NULL, NULL);
+	}
+	return sqlite3_busy_handler(db, wsq_busy_trampoline, handle);
+}
+
+// not static, low.go needs it for sqlite3_bind_pointer()
+void wsq_release_trampoline(void *handle)
+{
+	goRelease(handle);
+}
+
+static void wsq_function_trampoline(sqlite3_context *context, int argc, sqlite3_value **argv)
+{
+	goFunction(context, sqlite3_user_data(context), argc, argv);
+}
+
+int wsq_create_function(sqlite3 *db, const char *name, int nargs, int flags, void *handle)
+{
+	return sqlite3_create_function_v2(db, name, nargs, flags, handle,
+		wsq_function_trampoline, NULL, NULL, wsq_release_trampoline);
+}
+
+// SQLite keeps the handle of the Go Aggregate for each group in
+// the aggregate context, which is zeroed when first allocated.
+// Final gets a nil pointer if Step never ran, we don't want to
+// allocate anything just for that.
+
+static void wsq_step_trampoline(sqlite3_context *context, int argc, sqlite3_value **argv)
+{
+	void **state = sqlite3_aggregate_context(context, sizeof(void *));
+	if (state == NULL) {
+		sqlite3_result_error_nomem(context);
+		return;
+	}
+	goStep(context, sqlite3_user_data(context), state, argc, argv, 0);
+}
+
+static void wsq_inverse_trampoline(sqlite3_context *context, int argc, sqlite3_value **argv)
+{
+	void **state = sqlite3_aggregate_context(context, sizeof(void *));
+	if (state == NULL) {
+		sqlite3_result_error_nomem(context);
+		return;
+	}
+	goStep(context, sqlite3_user_data(context), state, argc, argv, 1);
+}
+
+static void wsq_final_trampoline(sqlite3_context *context)
+{
+	void **state = sqlite3_aggregate_context(context, 0);
+	goFinal(context, sqlite3_user_data(context), state, 1);
+}
+
+static void wsq_value_trampoline(sqlite3_context *context)
+{
+	void **state = sqlite3_aggregate_context(context, sizeof(void *));
+	if (state == NULL) {
+		sqlite3_result_error_nomem(context);
+		return;
+	}
+	goFinal(context, sqlite3_user_data(context), state, 0);
+}
+
+int wsq_create_aggregate(sqlite3 *db, const char *name, int nargs, int flags, void *handle, int window)
+{
+	if (window) {
+		return sqlite3_create_window_function(db, name, nargs, flags, handle,
+			wsq_step_trampoline, wsq_final_trampoline,
+			wsq_value_trampoline, wsq_inverse_trampoline,
+			wsq_release_trampoline);
+	}
+	return sqlite3_create_function_v2(db, name, nargs, flags, handle,
+		NULL, wsq_step_trampoline, wsq_final_trampoline,
+		wsq_release_trampoline);
+}
+
+static int wsq_collation_trampoline(void *handle, int na, const void *a, int nb, const void *b)
+{
+	return goCollation(handle, na, (void *) a, nb, (void *) b);
+}
+
+int wsq_create_collation(sqlite3 *db, const char *name, void *handle)
+{
+	if (handle == NULL) {
+		return sqlite3_create_collation_v2(db, name, SQLITE_UTF8, NULL, NULL, NULL);
+	}
+	return sqlite3_create_collation_v2(db, name, SQLITE_UTF8, handle,
+		wsq_collation_trampoline, wsq_release_trampoline);
+}
+
+// Virtual tables. Our tables and cursors are SQLite's structs
+// extended by the handle of the Go value they belong to. Error
+// messages come back from Go malloc()ed, SQLite wants them in
+// memory from sqlite3_malloc() instead.
+
+typedef struct wsq_vtab {
+	sqlite3_vtab base;
+	void *handle;
+} wsq_vtab;
+
+typedef struct wsq_cursor {
+	sqlite3_vtab_cursor base;
+	void *handle;
+} wsq_cursor;
+
+#define VTAB_HANDLE(vtab) (((wsq_vtab *) (vtab))->handle)
+#define CURSOR_HANDLE(cursor) (((wsq_cursor *) (cursor))->handle)
+
+static int wsq_vtab_error(sqlite3_vtab *vtab, int rc, char *message)
+{
+	if (message != NULL) {
+		sqlite3_free(vtab->zErrMsg);
+		vtab->zErrMsg = sqlite3_mprintf("%s", message);
+		free(message);
+	}
+	return rc;
+}
+
+static int wsq_vtab_init(sqlite3 *db, void *module, int argc, const char *const *argv,
+	sqlite3_vtab **vtab, char **err, int create)
+{
+	void *table = NULL;
+	char *schema = NULL;
+	char *message = NULL;
+	wsq_vtab *v = NULL;
+	int rc;
+
+	rc = goVTabInit(module, argc, (void *) argv, &table, &schema, &message, create);
+	if (rc != SQLITE_OK) {
+		if (message != NULL) {
+			*err = sqlite3_mprintf("%s", message);
+			free(message);
+		}
+		return rc;
+	}
+
+	rc = sqlite3_declare_vtab(db, schema);
+	free(schema);
+	if (rc == SQLITE_OK) {
+		v = sqlite3_malloc(sizeof(*v));
+		if (v == NULL) {
+			rc = SQLITE_NOMEM;
+		}
+	}
+	if (rc != SQLITE_OK) {
+		goVTabRelease(table, 0, &message);
+		free(message);
+		return rc;
+	}
+
+	memset(v, 0, sizeof(*v));
+	v->handle = table;
+	*vtab = &v->base;
+	return SQLITE_OK;
+}
+
+static int wsq_vtab_create(sqlite3 *db, void *module, int argc, const char *const *argv,
+	sqlite3_vtab **vtab, char **err)
+{
+	return wsq_vtab_init(db, module, argc, argv, vtab, err, 1);
+}
+
+static int wsq_vtab_connect(sqlite3 *db, void *module, int argc, const char *const *argv,
+	sqlite3_vtab **vtab, char **err)
+{
+	return wsq_vtab_init(db, module, argc, argv, vtab, err, 0);
+}
+
+static int wsq_vtab_best_index(sqlite3_vtab *vtab, sqlite3_index_info *info)
+{
+	char *message = NULL;
+	int rc = goVTabBestIndex(VTAB_HANDLE(vtab), info, &message);
+	return wsq_vtab_error(vtab, rc, message);
+}
+
+static int wsq_vtab_release(sqlite3_vtab *vtab, int destroy)
+{
+	char *message = NULL;
+	int rc = goVTabRelease(VTAB_HANDLE(vtab), destroy, &message);
+	if (rc != SQLITE_OK && destroy) {
+		// the table stays around
+		return wsq_vtab_error(vtab, rc, message);
+	}
+	free(message);
+	sqlite3_free(vtab->zErrMsg);
+	sqlite3_free(vtab);
+	return SQLITE_OK;
+}
+
+static int wsq_vtab_disconnect(sqlite3_vtab *vtab)
+{
+	return wsq_vtab_release(vtab, 0);
+}
+
+static int wsq_vtab_destroy(sqlite3_vtab *vtab)
+{
+	return wsq_vtab_release(vtab, 1);
+}
+
+static int wsq_vtab_open(sqlite3_vtab *vtab, sqlite3_vtab_cursor **cursor)
+{
+	char *message = NULL;
+	void *handle = NULL;
+	wsq_cursor *c;
+	int rc;
+
+	rc = goVTabOpen(VTAB_HANDLE(vtab), &handle, &message);
+	if (rc != SQLITE_OK) {
+		return wsq_vtab_error(vtab, rc, message);
+	}
+
+	c = sqlite3_malloc(sizeof(*c));
+	if (c == NULL) {
+		goCursorClose(handle);
+		return SQLITE_NOMEM;
+	}
+	memset(c, 0, sizeof(*c));
+	c->handle = handle;
+	*cursor = &c->base;
+	return SQLITE_OK;
+}
+
+static int wsq_vtab_update(sqlite3_vtab *vtab, int argc, sqlite3_value **argv, sqlite3_int64 *rowid)
+{
+	char *message = NULL;
+	int rc = goVTabUpdate(VTAB_HANDLE(vtab), argc, argv, rowid, &message);
+	return wsq_vtab_error(vtab, rc, message);
+}
+
+static int wsq_cursor_close(sqlite3_vtab_cursor *cursor)
+{
+	int rc = goCursorClose(CURSOR_HANDLE(cursor));
+	sqlite3_free(cursor);
+	return rc;
+}
+
+static int wsq_cursor_filter(sqlite3_vtab_cursor *cursor, int idxNum, const char *idxStr,
+	int argc, sqlite3_value **argv)
+{
+	char *message = NULL;
+	int rc = goCursorFilter(CURSOR_HANDLE(cursor), idxNum, (void *) idxStr, argc, argv, &message);
+	return wsq_vtab_error(cursor->pVtab, rc, message);
+}
+
+static int wsq_cursor_next(sqlite3_vtab_cursor *cursor)
+{
+	char *message = NULL;
+	int rc = goCursorNext(CURSOR_HANDLE(cursor), &message);
+	return wsq_vtab_error(cursor->pVtab, rc, message);
+}
+
+static int wsq_cursor_eof(sqlite3_vtab_cursor *cursor)
+{
+	return goCursorEOF(CURSOR_HANDLE(cursor));
+}
+
+static int wsq_cursor_column(sqlite3_vtab_cursor *cursor, sqlite3_context *context, int col)
+{
+	return goCursorColumn(CURSOR_HANDLE(cursor), context, col);
+}
+
+static int wsq_cursor_rowid(sqlite3_vtab_cursor *cursor, sqlite3_int64 *rowid)
+{
+	char *message = NULL;
+	int rc = goCursorRowid(CURSOR_HANDLE(cursor), rowid, &message);
+	return wsq_vtab_error(cursor->pVtab, rc, message);
+}
+
+static sqlite3_module wsq_module = {
+	1,			// iVersion
+	wsq_vtab_create,
+	wsq_vtab_connect,
+	wsq_vtab_best_index,
+	wsq_vtab_disconnect,
+	wsq_vtab_destroy,
+	wsq_vtab_open,
+	wsq_cursor_close,
+	wsq_cursor_filter,
+	wsq_cursor_next,
+	wsq_cursor_eof,
+	wsq_cursor_column,
+	wsq_cursor_rowid,
+	wsq_vtab_update,
+	// everything else stays NULL: no transactions,
+	// no overloaded functions, no renaming
+};
+
+// Same as wsq_module but without xCreate, which makes the module
+// eponymous-only: its tables can't be created, they just exist
+// under the name of the module, see table-valued functions.
+static sqlite3_module wsq_eponymous_module = {
+	1,			// iVersion
+	NULL,
+	wsq_vtab_connect,
+	wsq_vtab_best_index,
+	wsq_vtab_disconnect,
+	wsq_vtab_destroy,
+	wsq_vtab_open,
+	wsq_cursor_close,
+	wsq_cursor_filter,
+	wsq_cursor_next,
+	wsq_cursor_eof,
+	wsq_cursor_column,
+	wsq_cursor_rowid,
+	wsq_vtab_update,
+};
+
+int wsq_create_module(sqlite3 *db, const char *name, void *handle, int eponymous)
+{
+	sqlite3_module *module = eponymous ? &wsq_eponymous_module : &wsq_module;
+	return sqlite3_create_module_v2(db, name, module, handle, wsq_release_trampoline);
+}
+
+// Update, commit and rollback hooks all share a single handle,
+// see hooks.go.
+
+static void wsq_update_trampoline(void *handle, int op, const char *database,
+	const char *table, sqlite3_int64 rowid)
+{
+	goUpdateHook(handle, op, (void *) database, (void *) table, &rowid);
+}
+
+static int wsq_commit_trampoline(void *handle)
+{
+	return goCommitHook(handle);
+}
+
+static void wsq_rollback_trampoline(void *handle)
+{
+	goRollbackHook(handle);
+}
+
+void wsq_set_hooks(sqlite3 *db, void *handle)
+{
+	if (handle == NULL) {
+		sqlite3_update_hook(db, NULL, NULL);
+		sqlite3_commit_hook(db, NULL, NULL);
+		sqlite3_rollback_hook(db, NULL, NULL);
+		return;
+	}
+	sqlite3_update_hook(db, wsq_update_trampoline, handle);
+	sqlite3_commit_hook(db, wsq_commit_trampoline, handle);
+	sqlite3_rollback_hook(db, wsq_rollback_trampoline, handle);
+}
+
+static int wsq_authorizer_trampoline(void *handle, int action, const char *arg1,
+	const char *arg2, const char *database, const char *trigger)
+{
+	return goAuthorizer(handle, action, (void *) arg1, (void *) arg2, (void *) database, (void *) trigger);
+}
+
+int wsq_set_authorizer(sqlite3 *db, void *handle)
+{
+	if (handle == NULL) {
+		return sqlite3_set_authorizer(db, NULL, NULL);
+	}
+	return sqlite3_set_authorizer(db, wsq_authorizer_trampoline, handle);
+}
+
+// SQLite hands us different things for different trace events,
+// we sort them out here so Go gets strings and numbers only.
+static int wsq_trace_trampoline(unsigned event, void *handle, void *p, void *x)
+{
+	sqlite3_stmt *statement = (sqlite3_stmt *) p;
+	char *expanded = NULL;
+
+	switch (event) {
+	case SQLITE_TRACE_STMT:
+		expanded = sqlite3_expanded_sql(statement);
+		goTrace(handle, event, x, expanded, NULL);
+		break;
+	case SQLITE_TRACE_PROFILE:
+		expanded = sqlite3_expanded_sql(statement);
+		goTrace(handle, event, (void *) sqlite3_sql(statement), expanded, x);
+		break;
+	case SQLITE_TRACE_ROW:
+		goTrace(handle, event, (void *) sqlite3_sql(statement), NULL, NULL);
+		break;
+	case SQLITE_TRACE_CLOSE:
+		goTrace(handle, event, NULL, NULL, NULL);
+		break;
+	}
+
+	sqlite3_free(expanded);
+	return 0;
+}
+
+int wsq_trace(sqlite3 *db, int mask, void *handle)
+{
+	if (handle == NULL) {
+		return sqlite3_trace_v2(db, 0, NULL, NULL);
+	}
+	return sqlite3_trace_v2(db, mask, wsq_trace_trampoline, handle);
+}
+
+static int wsq_progress_trampoline(void *handle)
+{
+	return goProgressHandler(handle);
+}
+
+void wsq_progress_handler(sqlite3 *db, int ops, void *handle)
+{
+	if (handle == NULL) {
+		sqlite3_progress_handler(db, 0, NULL, NULL);
+		return;
+	}
+	sqlite3_progress_handler(db, ops, wsq_progress_trampoline, handle);
+}
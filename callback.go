@@ -0,0 +1,454 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Callbacks from SQLite into Go. The C side of each callback is
+// a small trampoline in callback.c that passes its "user data"
+// pointer on to one of the exported Go functions below.
+//
+// We never hand Go pointers to SQLite. Instead, the user data is
+// a handle into our registry, which maps handles to Go values and
+// keeps those values alive for as long as SQLite might call back.
+// Note that cgo insists on declarations only in this preamble,
+// definitions go into callback.c instead.
+
+/*
+#include <sqlite3.h>
+*/
+import "C"
+
+import (
+	"fmt";
+	"os";
+	"sync";
+	"unsafe";
+)
+
+var registry = make(map[uintptr]interface{})
+var registryLock sync.Mutex
+var registryLast uintptr
+
+// Register value and return a handle for it. Handles are never
+// nil, so SQLite can tell them apart from "no user data".
+func register(value interface{}) unsafe.Pointer {
+	registryLock.Lock();
+	defer registryLock.Unlock();
+	registryLast++;
+	registry[registryLast] = value;
+	return unsafe.Pointer(registryLast);
+}
+
+func lookup(handle unsafe.Pointer) interface{} {
+	registryLock.Lock();
+	defer registryLock.Unlock();
+	return registry[uintptr(handle)];
+}
+
+func unregister(handle unsafe.Pointer) {
+	registryLock.Lock();
+	defer registryLock.Unlock();
+	registry[uintptr(handle)] = nil, false;
+}
+
+// Remember handle as the connection's callback for the given
+// purpose, unregistering whatever was there before. A nil handle
+// just unregisters.
+func (self *Connection) setCallback(purpose string, handle unsafe.Pointer) {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	self.swapCallback(purpose, handle);
+}
+
+// Same as setCallback(), with the lock held.
+func (self *Connection) swapCallback(purpose string, handle unsafe.Pointer) {
+	if self.callbacks == nil {
+		self.callbacks = make(map[string]unsafe.Pointer)
+	}
+	if old, ok := self.callbacks[purpose]; ok {
+		unregister(old)
+	}
+	if handle != nil {
+		self.callbacks[purpose] = handle
+	} else {
+		self.callbacks[purpose] = nil, false
+	}
+}
+
+// Unregister all callbacks, only safe once SQLite is done with
+// the connection. Must be called with the lock held.
+func (self *Connection) releaseCallbacks() {
+	for _, handle := range self.callbacks {
+		unregister(handle)
+	}
+	self.callbacks = nil;
+}
+
+//export goBusyHandler
+func goBusyHandler(handle unsafe.Pointer, count C.int) (retry C.int) {
+	defer func() {
+		// a panic means give up, we can't let it
+		// unwind through SQLite
+		if x := recover(); x != nil {
+			retry = 0
+		}
+	}();
+
+	handler := lookup(handle).(BusyHandler);
+	if handler(int(count)) {
+		retry = 1
+	}
+	return;
+}
+
+//export goProgressHandler
+func goProgressHandler(handle unsafe.Pointer) (abort C.int) {
+	defer func() {
+		// a panic aborts, same as for functions
+		if x := recover(); x != nil {
+			abort = 1
+		}
+	}();
+
+	handler := lookup(handle).(ProgressHandler);
+	if handler() {
+		abort = 1
+	}
+	return;
+}
+
+//export goRelease
+func goRelease(handle unsafe.Pointer) {
+	unregister(handle)
+}
+
+//export goFunction
+func goFunction(context unsafe.Pointer, handle unsafe.Pointer, argc C.int, argv unsafe.Pointer) {
+	ctx := &sqlContext{(*C.sqlite3_context)(context)};
+	defer func() {
+		if x := recover(); x != nil {
+			ctx.sqlResultError(fmt.Sprintf("panic: %v", x))
+		}
+	}();
+
+	f := lookup(handle).(*function);
+	f.call(ctx, sqlValues(int(argc), argv));
+}
+
+//export goStep
+func goStep(context unsafe.Pointer, handle unsafe.Pointer, state unsafe.Pointer, argc C.int, argv unsafe.Pointer, inverse C.int) {
+	ctx := &sqlContext{(*C.sqlite3_context)(context)};
+	defer func() {
+		if x := recover(); x != nil {
+			ctx.sqlResultError(fmt.Sprintf("panic: %v", x))
+		}
+	}();
+
+	a := lookup(handle).(*aggregate);
+	a.step(ctx, (*unsafe.Pointer)(state), sqlValues(int(argc), argv), inverse != 0);
+}
+
+//export goFinal
+func goFinal(context unsafe.Pointer, handle unsafe.Pointer, state unsafe.Pointer, final C.int) {
+	ctx := &sqlContext{(*C.sqlite3_context)(context)};
+	defer func() {
+		if x := recover(); x != nil {
+			ctx.sqlResultError(fmt.Sprintf("panic: %v", x))
+		}
+	}();
+
+	a := lookup(handle).(*aggregate);
+	a.final(ctx, (*unsafe.Pointer)(state), final != 0);
+}
+
+//export goUpdateHook
+func goUpdateHook(handle unsafe.Pointer, op C.int, database unsafe.Pointer, table unsafe.Pointer, rowid unsafe.Pointer) {
+	// nothing we could do about a panic here, we
+	// just don't let it unwind through SQLite
+	defer func() { recover() }();
+
+	h := lookup(handle).(*hooks);
+	h.update(int(op), C.GoString((*C.char)(database)), C.GoString((*C.char)(table)), int64(*(*C.sqlite3_int64)(rowid)));
+}
+
+//export goCommitHook
+func goCommitHook(handle unsafe.Pointer) (rollback C.int) {
+	defer func() {
+		// better safe than sorry
+		if x := recover(); x != nil {
+			rollback = 1
+		}
+	}();
+
+	h := lookup(handle).(*hooks);
+	if !h.commit() {
+		rollback = 1
+	}
+	return;
+}
+
+//export goRollbackHook
+func goRollbackHook(handle unsafe.Pointer) {
+	defer func() { recover() }();
+
+	h := lookup(handle).(*hooks);
+	h.rollback();
+}
+
+//export goAuthorizer
+func goAuthorizer(handle unsafe.Pointer, action C.int, arg1 unsafe.Pointer, arg2 unsafe.Pointer, database unsafe.Pointer, trigger unsafe.Pointer) (result C.int) {
+	defer func() {
+		// when in doubt, deny
+		if x := recover(); x != nil {
+			result = C.int(AuthDeny)
+		}
+	}();
+
+	authorizer := lookup(handle).(Authorizer);
+	// C.GoString() turns NULL into ""
+	return C.int(authorizer(int(action),
+		C.GoString((*C.char)(arg1)), C.GoString((*C.char)(arg2)),
+		C.GoString((*C.char)(database)), C.GoString((*C.char)(trigger))));
+}
+
+//export goTrace
+func goTrace(handle unsafe.Pointer, event C.int, sql unsafe.Pointer, expanded unsafe.Pointer, nanoseconds unsafe.Pointer) {
+	// tracing must never break anything
+	defer func() { recover() }();
+
+	tracer := lookup(handle).(Tracer);
+	s := C.GoString((*C.char)(sql));
+	switch int(event) {
+	case TraceStmt:
+		tracer(&StmtEvent{s, C.GoString((*C.char)(expanded))})
+	case TraceProfile:
+		n := int64(*(*C.sqlite3_int64)(nanoseconds));
+		tracer(&ProfileEvent{s, C.GoString((*C.char)(expanded)), n});
+	case TraceRow:
+		tracer(&RowEvent{s})
+	case TraceClose:
+		tracer(&CloseEvent{})
+	}
+}
+
+//export goCollation
+func goCollation(handle unsafe.Pointer, na C.int, a unsafe.Pointer, nb C.int, b unsafe.Pointer) (result C.int) {
+	defer func() {
+		// there's no way to report errors from a
+		// collation, so a panic means "equal"
+		if x := recover(); x != nil {
+			result = 0
+		}
+	}();
+
+	compare := lookup(handle).(Collation);
+	sa := string(C.GoBytes(a, na));
+	sb := string(C.GoBytes(b, nb));
+	return C.int(compare(sa, sb));
+}
+
+// Virtual tables. Errors are reported through message, a char**
+// the C side passes on to SQLite (and then frees), see setMessage().
+
+func setMessage(message unsafe.Pointer, error os.Error) C.int {
+	if error == nil {
+		return StatusOk
+	}
+	*(**C.char)(message) = C.CString(error.String());
+	return StatusError;
+}
+
+//export goVTabInit
+func goVTabInit(handle unsafe.Pointer, argc C.int, argv unsafe.Pointer, table unsafe.Pointer, schema unsafe.Pointer, message unsafe.Pointer, create C.int) (rc C.int) {
+	defer func() {
+		if x := recover(); x != nil {
+			rc = setMessage(message, callbackError(x))
+		}
+	}();
+
+	a := (*[1 << 20]*C.char)(argv);
+	args := make([]string, int(argc));
+	for i := range args {
+		args[i] = C.GoString(a[i])
+	}
+
+	m := lookup(handle).(*module);
+	t, s, error := m.init(args, create != 0);
+	if error != nil {
+		return setMessage(message, error)
+	}
+
+	*(*unsafe.Pointer)(table) = register(t);
+	*(**C.char)(schema) = C.CString(s);
+	return StatusOk;
+}
+
+//export goVTabBestIndex
+func goVTabBestIndex(handle unsafe.Pointer, info unsafe.Pointer, message unsafe.Pointer) (rc C.int) {
+	defer func() {
+		if x := recover(); x != nil {
+			rc = setMessage(message, callbackError(x))
+		}
+	}();
+
+	t := lookup(handle).(*vtable);
+	ii := &sqlIndexInfo{(*C.sqlite3_index_info)(info)};
+	i := ii.sqlGet();
+	error := t.impl.BestIndex(i);
+	if error == nil {
+		ii.sqlSet(i)
+	}
+	return setMessage(message, error);
+}
+
+// Disconnect from or destroy a table. We let go of the handle
+// unless Destroy() fails, SQLite keeps the table in that case.
+//export goVTabRelease
+func goVTabRelease(handle unsafe.Pointer, destroy C.int, message unsafe.Pointer) (rc C.int) {
+	defer func() {
+		if x := recover(); x != nil {
+			rc = setMessage(message, callbackError(x))
+		}
+	}();
+
+	t := lookup(handle).(*vtable);
+	var error os.Error;
+	if destroy != 0 {
+		error = t.impl.Destroy();
+		if error != nil {
+			return setMessage(message, error)
+		}
+	} else {
+		error = t.impl.Disconnect()
+	}
+	unregister(handle);
+	return setMessage(message, error);
+}
+
+//export goVTabOpen
+func goVTabOpen(handle unsafe.Pointer, cursor unsafe.Pointer, message unsafe.Pointer) (rc C.int) {
+	defer func() {
+		if x := recover(); x != nil {
+			rc = setMessage(message, callbackError(x))
+		}
+	}();
+
+	t := lookup(handle).(*vtable);
+	c, error := t.open();
+	if error != nil {
+		return setMessage(message, error)
+	}
+	*(*unsafe.Pointer)(cursor) = register(c);
+	return StatusOk;
+}
+
+//export goVTabUpdate
+func goVTabUpdate(handle unsafe.Pointer, argc C.int, argv unsafe.Pointer, rowid unsafe.Pointer, message unsafe.Pointer) (rc C.int) {
+	defer func() {
+		if x := recover(); x != nil {
+			rc = setMessage(message, callbackError(x))
+		}
+	}();
+
+	t := lookup(handle).(*vtable);
+	r, error := t.update(sqlValues(int(argc), argv));
+	if error == nil {
+		*(*C.sqlite3_int64)(rowid) = C.sqlite3_int64(r)
+	}
+	return setMessage(message, error);
+}
+
+// The cursor is gone afterwards, no matter what.
+//export goCursorClose
+func goCursorClose(handle unsafe.Pointer) (rc C.int) {
+	defer unregister(handle);
+	defer func() {
+		if x := recover(); x != nil {
+			rc = StatusError
+		}
+	}();
+
+	c := lookup(handle).(*vcursor);
+	if c.impl.Close() != nil {
+		return StatusError
+	}
+	return StatusOk;
+}
+
+//export goCursorFilter
+func goCursorFilter(handle unsafe.Pointer, indexNumber C.int, indexString unsafe.Pointer, argc C.int, argv unsafe.Pointer, message unsafe.Pointer) (rc C.int) {
+	defer func() {
+		if x := recover(); x != nil {
+			rc = setMessage(message, callbackError(x))
+		}
+	}();
+
+	c := lookup(handle).(*vcursor);
+	s := C.GoString((*C.char)(indexString));
+	return setMessage(message, c.filter(int(indexNumber), s, sqlValues(int(argc), argv)));
+}
+
+//export goCursorNext
+func goCursorNext(handle unsafe.Pointer, message unsafe.Pointer) (rc C.int) {
+	defer func() {
+		if x := recover(); x != nil {
+			rc = setMessage(message, callbackError(x))
+		}
+	}();
+
+	c := lookup(handle).(*vcursor);
+	return setMessage(message, c.impl.Next());
+}
+
+//export goCursorEOF
+func goCursorEOF(handle unsafe.Pointer) (eof C.int) {
+	defer func() {
+		// there's no way to report errors here, so we
+		// just stop the scan
+		if x := recover(); x != nil {
+			eof = 1
+		}
+	}();
+
+	c := lookup(handle).(*vcursor);
+	if c.impl.EOF() {
+		eof = 1
+	}
+	return;
+}
+
+//export goCursorColumn
+func goCursorColumn(handle unsafe.Pointer, context unsafe.Pointer, col C.int) (rc C.int) {
+	ctx := &sqlContext{(*C.sqlite3_context)(context)};
+	defer func() {
+		if x := recover(); x != nil {
+			ctx.sqlResultError(callbackError(x).String());
+			rc = StatusError;
+		}
+	}();
+
+	c := lookup(handle).(*vcursor);
+	error := c.column(ctx, int(col));
+	if error != nil {
+		ctx.sqlResultError(error.String());
+		return StatusError;
+	}
+	return StatusOk;
+}
+
+//export goCursorRowid
+func goCursorRowid(handle unsafe.Pointer, rowid unsafe.Pointer, message unsafe.Pointer) (rc C.int) {
+	defer func() {
+		if x := recover(); x != nil {
+			rc = setMessage(message, callbackError(x))
+		}
+	}();
+
+	c := lookup(handle).(*vcursor);
+	r, error := c.impl.Rowid();
+	if error == nil {
+		*(*C.sqlite3_int64)(rowid) = C.sqlite3_int64(r)
+	}
+	return setMessage(message, error);
+}
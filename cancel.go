@@ -0,0 +1,238 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Cancelling long-running queries. The request was for context
+// style cancellation, but the Go release we're written against
+// has no context package (nor any other standard way to cancel
+// things), so we use channels: the variants of Prepare(),
+// ExecuteClassic() and Fetch() below take a done channel, and
+// once a value can be received from it (or it is closed) the
+// operation is interrupted with sqlite3_interrupt() and fails
+// with a SystemError carrying StatusInterrupt. Use Timeout() for
+// deadlines. A done channel is all a context would give us here
+// anyway, and it's easy to close one from a context later.
+//
+// Beware that sqlite3_interrupt() aborts every statement running
+// on the connection, not just ours. We only interrupt while the
+// operation we're watching is in progress, but if other goroutines
+// share the connection, their statements fail as well. Give every
+// goroutine that needs cancelling a connection of its own (a Pool
+// helps).
+
+import (
+	"db";
+	"os";
+	"sync";
+	"time";
+	"unsafe";
+)
+
+// A channel that is closed after the given number of
+// nanoseconds, suitable as a done channel.
+func Timeout(ns int64) <-chan bool {
+	c := make(chan bool);
+	go func() {
+		time.Sleep(ns);
+		close(c);
+	}();
+	return c;
+}
+
+// Interrupt whatever the connection is doing right now; every
+// statement in progress fails with StatusInterrupt, whoever runs
+// it. Safe to call from any goroutine.
+func (self *Connection) Interrupt() {
+	self.handle.sqlInterrupt()
+}
+
+func interrupted(where string) os.Error {
+	return &SystemError{where + ": interrupted", StatusInterrupt, StatusInterrupt}
+}
+
+// Has done fired already?
+func isDone(done <-chan bool) bool {
+	select {
+	case <-done:
+		return true
+	default:
+	}
+	return false;
+}
+
+// Interrupts the connection if done fires while one of our
+// operations is in progress, that is between begin() and end().
+// If done fires in between operations, we leave the connection
+// alone and the next begin() fails instead. One watcher can be
+// used for any number of operations, say all fetches from a
+// result set, until stop() is called.
+type watcher struct {
+	connection	*Connection;
+	done		<-chan bool;
+	quit		chan bool;
+	lock		sync.Mutex;	// protects the rest
+	cancelled	bool;	// done fired
+	active		bool;	// an operation is in progress
+	fired		bool;	// and we interrupted it
+}
+
+func (self *Connection) watch(done <-chan bool) (w *watcher) {
+	w = new(watcher);
+	w.connection = self;
+	w.done = done;
+	w.quit = make(chan bool);
+	go func() {
+		select {
+		case <-done:
+			w.lock.Lock();
+			w.cancelled = true;
+			if w.active {
+				self.Interrupt();
+				w.fired = true;
+			}
+			w.lock.Unlock();
+		case <-w.quit:
+		}
+	}();
+	return;
+}
+
+// Start an operation, false if done fired already.
+func (self *watcher) begin() bool {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	// don't wait for the goroutine to notice
+	if !self.cancelled && isDone(self.done) {
+		self.cancelled = true
+	}
+	if self.cancelled {
+		return false
+	}
+	self.active = true;
+	return true;
+}
+
+// The operation is over; did we interrupt it? Done can fire just
+// after the operation finished but before we got here; the
+// interrupt then hits whatever runs next on the connection, so
+// callers have to clean up and fail right away.
+func (self *watcher) end() (fired bool) {
+	self.lock.Lock();
+	fired = self.fired;
+	self.active = false;
+	self.fired = false;
+	self.lock.Unlock();
+	return;
+}
+
+// Stop watching altogether.
+func (self *watcher) stop() {
+	close(self.quit)
+}
+
+// Like Prepare(), but gives up once done fires.
+func (self *Connection) PrepareCancel(done <-chan bool, query string) (statement db.Statement, error os.Error) {
+	w := self.watch(done);
+	defer w.stop();
+	if !w.begin() {
+		error = interrupted("Prepare");
+		return;
+	}
+	statement, error = self.Prepare(query);
+	if w.end() && error == nil {
+		// ignore potential secondary error
+		_ = statement.Close();
+		statement = nil;
+		error = interrupted("Prepare");
+	}
+	return;
+}
+
+// Like ExecuteClassic(), but gives up once done fires. Calls to
+// FetchCancel() with the same done channel keep watching it
+// without starting over.
+func (self *Connection) ExecuteClassicCancel(done <-chan bool, statement db.Statement, parameters ...interface{}) (rset db.ClassicResultSet, error os.Error) {
+	w := self.watch(done);
+	if !w.begin() {
+		w.stop();
+		error = interrupted("Execute");
+		return;
+	}
+	rset, error = self.ExecuteClassic(statement, parameters...);
+	if w.end() && error == nil {
+		// ignore potential secondary error
+		_ = rset.Close();
+		rset = nil;
+		error = interrupted("Execute");
+	}
+
+	if rs, ok := rset.(*ClassicResultSet); ok && rs.more {
+		rs.watcher = w
+	} else {
+		w.stop()
+	}
+	return;
+}
+
+// Like Fetch(), but gives up once done fires. The result set
+// is finished after that. We watch done until the result set
+// is finished, not just during this call, so fetching all rows
+// with the same channel only takes one extra goroutine.
+func (self *ClassicResultSet) FetchCancel(done <-chan bool) (result db.Result) {
+	if self.watcher == nil || self.watcher.done != done {
+		self.unwatch();
+		if self.more {
+			self.watcher = self.connection.watch(done)
+		}
+	}
+
+	w := self.watcher;
+	if w == nil {
+		// nothing left to fetch, Fetch() says so
+		return self.Fetch()
+	}
+	if !w.begin() {
+		res := new(Result);
+		res.error = interrupted("Fetch");
+		_ = self.Close();
+		result = res;
+		return;
+	}
+	result = self.Fetch();
+	if w.end() && result.Error() == nil {
+		res := new(Result);
+		res.error = interrupted("Fetch");
+		_ = self.Close();
+		result = res;
+	}
+	return;
+}
+
+// Stop watching for FetchCancel(), if we were.
+func (self *ClassicResultSet) unwatch() {
+	if self.watcher != nil {
+		self.watcher.stop();
+		self.watcher = nil;
+	}
+}
+
+// Called every so often while a statement runs, see
+// SetProgressHandler(). Return true to abort the statement.
+type ProgressHandler func() bool
+
+// Call handler roughly every ops virtual machine instructions
+// while a statement runs, replacing the previous handler. If it
+// returns true, the statement fails with StatusInterrupt. A nil
+// handler or ops <= 0 removes the handler. Unlike a done channel,
+// this needs no extra goroutine, but like a BusyHandler the
+// handler must not use the connection.
+func (self *Connection) SetProgressHandler(ops int, handler ProgressHandler) {
+	var handle unsafe.Pointer;
+	if handler != nil && ops > 0 {
+		handle = register(handler)
+	}
+	self.handle.sqlProgressHandler(ops, handle);
+	self.setCallback("progress", handle);
+}
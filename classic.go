@@ -14,33 +14,8 @@ package sqlite3
 import (
 	"db";
 	"os";
-	"reflect";
 )
 
-// stolen from fmt package, special-cases interface values
-func getField(v *reflect.Value, i int) reflect.Value {
-	val := v.Index(i)
-
-	if val.CanInterface() {
-		if inter := val.Interface(); inter != nil {
-			return reflect.ValueOf(inter)
-		}
-	}
-
-	return val;
-}
-
-func struct2array(s *reflect.Value) (r []reflect.Value) {
-	l := s.Len();
-	r = make([]reflect.Value, l);
-
-	for i := 0; i < l; i++ {
-		r[i] = getField(s, i)
-	}
-
-	return;
-}
-
 // Execute precompiled statement with given parameters
 // (if any). The statement stays valid even if we fail
 // to execute with given parameters.
@@ -51,27 +26,14 @@ func (self *Connection) ExecuteClassic(statement db.Statement, parameters ...int
 		return;
 	}
 
-	p := reflect.ValueOf(parameters);
-
-	if p.Len() != s.handle.sqlBindParameterCount() {
-		error = &DriverError{"Execute: Number of parameters doesn't match!"};
+	error = s.bindAll(parameters);
+	if error != nil {
+		s.clear();
 		return;
 	}
 
-	pa := struct2array(&p);
-
-	for k, v := range pa {
-		q := v.String();
-		rc := s.handle.sqlBindText(k, q);
-
-		if rc != StatusOk {
-			error = self.error();
-			s.clear();
-			return;
-		}
-	}
-
 	rc := s.handle.sqlStep();
+	self.stepped(rc == StatusDone || rc == StatusRow);
 
 	if rc != StatusDone && rc != StatusRow {
 		// presumably any other outcome is an error
@@ -80,16 +42,16 @@ func (self *Connection) ExecuteClassic(statement db.Statement, parameters ...int
 
 	if rc == StatusRow {
 		// statement is producing results, need a cursor
-		rs := new(ClassicResultSet);
-		rs.statement = s;
-		rs.connection = self;
+		rs := newClassicResultSet(self, s);
 		rs.more = true;
 		rset = rs;
+		// see cache.go
+		self.cache.lock.Lock();
+		s.results = rs;
+		self.cache.lock.Unlock();
 	} else if rc == StatusDone {
 		// even if there are no results, we should still return a result set
-		rs := new(ClassicResultSet);
-		rs.statement = s;
-		rs.connection = self;
+		rs := newClassicResultSet(self, s);
 		rs.more = false;
 		rset = rs;
 		s.clear()
@@ -106,6 +68,18 @@ type ClassicResultSet struct {
 	statement	*Statement;
 	connection	*Connection;
 	more		bool;	// still have results left
+	names		[]string;	// column names, the statement may be gone later
+	types		[]string;	// declared column types, likewise
+	watcher		*watcher;	// for FetchCancel(), see cancel.go
+}
+
+func newClassicResultSet(conn *Connection, s *Statement) (rs *ClassicResultSet) {
+	rs = new(ClassicResultSet);
+	rs.statement = s;
+	rs.connection = conn;
+	rs.names = s.names();
+	rs.types = s.types();
+	return;
 }
 
 // TODO
@@ -133,55 +107,84 @@ func (self *ClassicResultSet) Fetch() (result db.Result) {
 	}
 	res.data = make([]interface{}, nColumns);
 	for i := 0; i < nColumns; i++ {
-		res.data[i] = self.statement.handle.sqlColumnText(i);
+		res.data[i] = self.statement.column(i);
 	}
+	res.names = self.names;
+	res.timeFormat = self.connection.timeFormat;
 
 	// try to get another row
 	rc := self.statement.handle.sqlStep();
+	self.connection.stepped(rc == StatusDone || rc == StatusRow);
 
 	if rc != StatusDone && rc != StatusRow {
 		// presumably any other outcome is an error
 		// TODO: is res.error the right place?
-		res.error = self.connection.error()
+		res.error = self.connection.error();
+		// no way to go on after an error (or an
+		// interrupt), so we're done
+		rc = StatusDone;
 	}
 
 	if rc == StatusDone {
 		self.more = false;
 		// clean up when done
 		self.statement.clear();
+		self.statement.finished(self);
+		self.unwatch();
 	}
 
 	return;
 }
 
-// TODO
-// TODO: reset statement here as well, just like in Fetch
-func (self *ClassicResultSet) Close() os.Error {
-	return nil;
+// Value of a column in the current row, typed according to
+// its storage class in SQLite.
+func (self *Statement) column(i int) (value interface{}) {
+	switch self.handle.sqlColumnType(i) {
+	case sqlIntegerType:
+		value = self.handle.sqlColumnInt64(i);
+	case sqlFloatType:
+		value = self.handle.sqlColumnDouble(i);
+	case sqlTextType:
+		value = self.handle.sqlColumnText(i);
+	case sqlBlobType:
+		value = self.handle.sqlColumnBlob(i);
+	case sqlNullType:
+		value = nil;
+	default:
+		sqlPanic("unknown column type");
+	}
+	return;
 }
 
-// TODO
-// TODO: what if something goes wrong? error? :-/
-func (self *ClassicResultSet) Names() (names []string) {
-	cols := self.statement.handle.sqlColumnCount();
-	if cols == 0 {
-		return;
-	}
-	names = make([]string, cols);
-	for i := 0; i < cols; i++ {
-		names[i] = self.statement.handle.sqlColumnName(i);
+// Stop fetching results. The statement that produced them
+// is reset and ready for another execution, just like after
+// Fetch() ran out of results.
+func (self *ClassicResultSet) Close() (error os.Error) {
+	if self.more {
+		self.more = false;
+		error = self.statement.clear();
+		self.statement.finished(self);
 	}
+	self.unwatch();
 	return;
 }
 
-func (self *ClassicResultSet) Types() (names []string) {
-	cols := self.statement.handle.sqlColumnCount();
-	if cols == 0 {
+// Names of the result columns.
+func (self *ClassicResultSet) Names() []string {
+	return self.names;
+}
+
+// Declared types of the result columns, "" for expressions.
+func (self *ClassicResultSet) Types() []string {
+	return self.types;
+}
+
+// Detailed information about the result columns. Only available
+// as long as the statement is, see Statement.Close().
+func (self *ClassicResultSet) Columns() (columns []ColumnInfo, error os.Error) {
+	if self.statement.handle == nil {
+		error = &DriverError{"Columns: Statement closed!"};
 		return;
 	}
-	names = make([]string, cols);
-	for i := 0; i < cols; i++ {
-		names[i] = self.statement.handle.sqlColumnDeclaredType(i);
-	}
-	return;
+	return self.statement.Columns();
 }
@@ -0,0 +1,112 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"os";
+	"strings";
+	"unicode";
+	"unsafe";
+	"utf8";
+)
+
+// Compares two strings for a collation: negative if a sorts
+// before b, positive if a sorts after b, 0 if they're equal.
+// Must be consistent, see http://www.sqlite.org/c3ref/create_collation.html,
+// otherwise indexes using the collation break.
+type Collation func(a, b string) int
+
+// Make compare available as a collation called name, for example
+// in ORDER BY and COLLATE clauses or in indexes. We keep compare
+// around until the collation is replaced or the connection is
+// closed. A nil compare removes the collation.
+func (self *Connection) RegisterCollation(name string, compare Collation) (error os.Error) {
+	var handle unsafe.Pointer;
+	if compare != nil {
+		handle = register(compare)
+	}
+
+	rc := self.handle.sqlCreateCollation(name, handle);
+	if rc != StatusOk {
+		error = self.error();
+		// SQLite doesn't release the handle on failure,
+		// unlike for functions
+		if handle != nil {
+			unregister(handle)
+		}
+	}
+	return;
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0;
+}
+
+func fold(r int) int	{ return unicode.ToLower(unicode.ToUpper(r)) }
+
+// Collation that ignores case for all of Unicode, unlike the
+// built-in NOCASE which only handles ASCII.
+func UnicodeNoCase(a, b string) int {
+	for len(a) > 0 && len(b) > 0 {
+		ra, na := utf8.DecodeRuneInString(a);
+		rb, nb := utf8.DecodeRuneInString(b);
+		if c := compareInts(fold(ra), fold(rb)); c != 0 {
+			return c
+		}
+		a, b = a[na:], b[nb:];
+	}
+	return compareInts(len(a), len(b));
+}
+
+func isDigit(c byte) bool	{ return '0' <= c && c <= '9' }
+
+// Length of the run of digits at the start of s.
+func digits(s string) (n int) {
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return;
+}
+
+// Collation that compares runs of digits by their numeric value,
+// so "file9" sorts before "file10". Everything else is compared
+// character by character. Leading zeros are ignored, so "a01"
+// and "a1" are equal.
+func Natural(a, b string) int {
+	for len(a) > 0 && len(b) > 0 {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			da, db := digits(a), digits(b);
+			na := strings.TrimLeft(a[0:da], "0");
+			nb := strings.TrimLeft(b[0:db], "0");
+			// more digits means a bigger number, for the
+			// same number of digits plain comparison works
+			if c := compareInts(len(na), len(nb)); c != 0 {
+				return c
+			}
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1;
+			}
+			a, b = a[da:], b[db:];
+			continue;
+		}
+
+		ra, na := utf8.DecodeRuneInString(a);
+		rb, nb := utf8.DecodeRuneInString(b);
+		if c := compareInts(ra, rb); c != 0 {
+			return c
+		}
+		a, b = a[na:], b[nb:];
+	}
+	return compareInts(len(a), len(b));
+}
@@ -0,0 +1,75 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Information about result columns. Most of it is available as
+// soon as a statement is prepared, see Statement.Columns(). The
+// origin of a column (and everything we learn from it) requires
+// SQLite compiled with SQLITE_ENABLE_COLUMN_METADATA, which most
+// distributions do.
+
+import "os"
+
+// A result column.
+type ColumnInfo struct {
+	Name		string;	// as in the result, including AS renames
+	DeclaredType	string;	// "" for expressions
+
+	// Where the column comes from, all "" for expressions.
+	Database	string;
+	Table		string;
+	Column		string;
+
+	// Constraints on the origin column, all false for
+	// expressions.
+	NotNull		bool;
+	PrimaryKey	bool;
+	AutoIncrement	bool;
+}
+
+func (self *Statement) names() (names []string) {
+	n := self.handle.sqlColumnCount();
+	names = make([]string, n);
+	for i := 0; i < n; i++ {
+		names[i] = self.handle.sqlColumnName(i)
+	}
+	return;
+}
+
+func (self *Statement) types() (types []string) {
+	n := self.handle.sqlColumnCount();
+	types = make([]string, n);
+	for i := 0; i < n; i++ {
+		types[i] = self.handle.sqlColumnDeclaredType(i)
+	}
+	return;
+}
+
+// Information about each column the statement produces, empty
+// for statements that don't produce any.
+func (self *Statement) Columns() (columns []ColumnInfo, error os.Error) {
+	n := self.handle.sqlColumnCount();
+	c := make([]ColumnInfo, n);
+	for i := range c {
+		c[i].Name = self.handle.sqlColumnName(i);
+		c[i].DeclaredType = self.handle.sqlColumnDeclaredType(i);
+		c[i].Database = self.handle.sqlColumnDatabaseName(i);
+		c[i].Table = self.handle.sqlColumnTableName(i);
+		c[i].Column = self.handle.sqlColumnOriginName(i);
+		if len(c[i].Table) == 0 {
+			continue
+		}
+
+		var rc int;
+		c[i].NotNull, c[i].PrimaryKey, c[i].AutoIncrement, rc =
+			self.connection.handle.sqlTableColumnMetadata(c[i].Database, c[i].Table, c[i].Column);
+		if rc != StatusOk {
+			error = self.connection.error();
+			return;
+		}
+	}
+	columns = c;
+	return;
+}
@@ -7,11 +7,19 @@ package sqlite3
 import (
 	"db";
 	"os";
+	"strings";
+	"sync";
+	"unsafe";
 )
 
 // SQLite connections
 type Connection struct {
-	handle *sqlConnection;
+	handle		*sqlConnection;
+	timeFormat	string;	// layout for binding time values
+	lock		sync.Mutex;	// protects callbacks and hooks
+	callbacks	map[string]unsafe.Pointer;	// see setCallback()
+	hooks		*hooks;	// see hooks.go
+	cache		*statementCache;	// see cache.go
 }
 
 // Fill in a SystemError with information about
@@ -33,8 +41,14 @@ func (self *Connection) error() (error os.Error) {
 func (self *Connection) Prepare(query string) (statement db.Statement, error os.Error) {
 	s := new(Statement);
 	s.connection = self;
-	var rc int;
-	s.handle, rc = self.handle.sqlPrepare(query)
+	s.query = query;
+	if s.handle, s.generation = self.cache.get(query); s.handle != nil {
+		statement = s;
+		return;
+	}
+
+	var tail, rc int;
+	s.handle, tail, rc = self.handle.sqlPrepare(query)
 
 	if rc != StatusOk {
 		error = self.error();
@@ -49,15 +63,40 @@ func (self *Connection) Prepare(query string) (statement db.Statement, error os.
 		return;
 	}
 
+	if s.handle.handle == nil {
+		error = &DriverError{"Prepare: No SQL statement in query!"};
+		return;
+	}
+
+	if !self.onlyComments(query[tail:]) {
+		_ = s.handle.sqlFinalize();
+		error = &DriverError{"Prepare: More than one SQL statement in query, see ExecScript()!"};
+		return;
+	}
+
 	statement = s;
 	return;
 }
 
+// Is there nothing but whitespace and comments in rest? We let
+// SQLite decide, an error means there's something there.
+func (self *Connection) onlyComments(rest string) bool {
+	if len(strings.TrimSpace(rest)) == 0 {
+		return true
+	}
+	stat, _, rc := self.handle.sqlPrepare(rest);
+	if stat.handle != nil {
+		_ = stat.sqlFinalize();
+		return false;
+	}
+	return rc == StatusOk;
+}
+
 
 
 func (self *Connection) Execute(statement db.Statement, parameters ...interface{}) (rs db.ResultSet, error os.Error) {
 	var crs db.ClassicResultSet;
-	crs, error = self.ExecuteClassic(statement, parameters);
+	crs, error = self.ExecuteClassic(statement, parameters...);
 	if error != nil {
 		return
 	}
@@ -69,10 +108,19 @@ func (self *Connection) Execute(statement db.Statement, parameters ...interface{
 
 func (self *Connection) Close() (error os.Error) {
 	// TODO
+	// SQLite refuses to close with statements left over
+	self.cache.close();
+
 	rc := self.handle.sqlClose();
 	if rc != StatusOk {
-		error = self.error()
+		error = self.error();
+		return;
 	}
+	// SQLite won't call back anymore
+	self.lock.Lock();
+	self.releaseCallbacks();
+	self.hooks = nil;
+	self.lock.Unlock();
 	return;
 }
 
@@ -13,7 +13,8 @@ import (
 )
 
 // after we run into a locked database/table,
-// we'll retry for this long
+// we'll retry for this long unless the URL has
+// a "busy_timeout" option
 const defaultTimeoutMilliseconds = 16 * 1000
 
 // SQLite version information
@@ -48,7 +49,7 @@ func version() (data map[string]string, error os.Error) {
 	return;
 }
 
-func parseConnInfo(str string) (name string, flags int, vfs string, error os.Error) {
+func parseConnInfo(str string) (name string, flags int, vfs string, timeout int, error os.Error) {
 	var url *http.URL;
 
 	url, error = http.ParseURL(str);
@@ -70,6 +71,8 @@ func parseConnInfo(str string) (name string, flags int, vfs string, error os.Err
 		name = url.Path
 	}
 
+	timeout = defaultTimeoutMilliseconds;
+
 	if len(url.RawQuery) > 0 {
 		options, e := db.ParseQueryURL(url.RawQuery);
 		if e != nil {
@@ -84,6 +87,13 @@ func parseConnInfo(str string) (name string, flags int, vfs string, error os.Err
 			}
 		}
 		vfs, ok = options["vfs"];
+		rtimeout, ok := options["busy_timeout"];
+		if ok {
+			timeout, error = strconv.Atoi(rtimeout);
+			if error != nil {
+				return	// XXX really return error from Atoi?
+			}
+		}
 	}
 
 	return;
@@ -93,12 +103,24 @@ func open(url string) (connection db.Connection, error os.Error) {
 	var name string;
 	var flags int;
 	var vfs string;
+	var timeout int;
 
-	name, flags, vfs, error = parseConnInfo(url);
+	name, flags, vfs, timeout, error = parseConnInfo(url);
 	if error != nil {
 		return
 	}
 
+	var conn *Connection;
+	conn, error = openConnection(name, flags, vfs, timeout);
+	if error != nil {
+		return
+	}
+
+	connection = conn;
+	return;
+}
+
+func openConnection(name string, flags int, vfs string, timeout int) (conn *Connection, error os.Error) {
 	// We want all connections to be in serialized threading
 	// mode, so we fiddle with the flags to make sure.
 	flags &^= OpenNoMutex;
@@ -111,7 +133,9 @@ func open(url string) (connection db.Connection, error os.Error) {
 		flags |= OpenReadWrite
 	}
 
-	conn := new(Connection);
+	conn = new(Connection);
+	conn.timeFormat = DefaultTimeFormat;
+	conn.cache = newStatementCache(DefaultStatementCacheSize);
 	var rc int;
 	conn.handle, rc = sqlOpen(name, flags, vfs);
 
@@ -123,14 +147,16 @@ func open(url string) (connection db.Connection, error os.Error) {
 		if conn.handle != nil {
 			_ = conn.Close();
 		}
+		conn = nil;
 		return;
 	}
 
-	rc = conn.handle.sqlBusyTimeout(defaultTimeoutMilliseconds);
+	rc = conn.handle.sqlBusyTimeout(timeout);
 	if rc != StatusOk {
 		error = conn.error();
 		// ignore potential secondary error
 		_ = conn.Close();
+		conn = nil;
 		return;
 	}
 
@@ -139,10 +165,18 @@ func open(url string) (connection db.Connection, error os.Error) {
 		error = conn.error();
 		// ignore potential secondary error
 		_ = conn.Close();
+		conn = nil;
+		return;
+	}
+
+	error = conn.registerCarray();
+	if error != nil {
+		// ignore potential secondary error
+		_ = conn.Close();
+		conn = nil;
 		return;
 	}
 
-	connection = conn;
 	return;
 }
 
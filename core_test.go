@@ -8,6 +8,8 @@ import "testing"
 import "os"
 import "db"
 import "fmt"
+import "strconv"
+import "time"
 
 const (
 	impossibleName	= "randomassdatabase.db";
@@ -126,6 +128,1371 @@ func TestCreate(t *testing.T) {
 	c.Close();
 }
 
+// Execute(): parameters are bound with their natural types
+
+type bindTest struct {
+	value		interface{};
+	storage		string;
+}
+
+var bindTests = []bindTest{
+	bindTest{nil, "null"},
+	bindTest{42, "integer"},
+	bindTest{int64(-7), "integer"},
+	bindTest{uint8(3), "integer"},
+	bindTest{true, "integer"},
+	bindTest{3.25, "real"},
+	bindTest{"text", "text"},
+	bindTest{[]byte{0, 1, 2}, "blob"},
+	bindTest{[]byte{}, "blob"},
+}
+
+func TestBind(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	for _, k := range bindTests {
+		d, e := db.ExecuteDirectly(c, "SELECT typeof(?)", k.value);
+		if e != nil {
+			t.Errorf("Failed to bind %v: %s", k.value, e);
+			continue;
+		}
+		if len(d) != 1 || fmt.Sprint(d[0][0]) != k.storage {
+			t.Errorf("%v stored as %v, expected %s", k.value, d, k.storage)
+		}
+	}
+
+	_, e = db.ExecuteDirectly(c, "SELECT ?", make(chan int));
+	if e == nil {
+		t.Error("Bound a channel")
+	}
+}
+
+// Fetch(): results come back with their storage class
+
+func TestFetchTypes(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	d, e := db.ExecuteDirectly(c, "SELECT ?, ?, ?, ?, ?", 42, 2.5, "text", []byte{1, 2}, nil);
+	if e != nil || len(d) != 1 {
+		t.Fatalf("Failed to select: %s", e)
+	}
+	r := d[0];
+
+	if v, ok := r[0].(int64); !ok || v != 42 {
+		t.Errorf("expected int64 42, got %#v", r[0])
+	}
+	if v, ok := r[1].(float64); !ok || v != 2.5 {
+		t.Errorf("expected float64 2.5, got %#v", r[1])
+	}
+	if v, ok := r[2].(string); !ok || v != "text" {
+		t.Errorf("expected string \"text\", got %#v", r[2])
+	}
+	if v, ok := r[3].([]byte); !ok || len(v) != 2 || v[0] != 1 || v[1] != 2 {
+		t.Errorf("expected []byte{1, 2}, got %#v", r[3])
+	}
+	if r[4] != nil {
+		t.Errorf("expected nil, got %#v", r[4])
+	}
+}
+
+// Execute(): named parameters bound from maps and structs
+
+type namedTest struct {
+	Login	string	`db:"login"`;
+	Ignored	string	`db:"-"`;
+}
+
+func TestNamed(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	query := "SELECT password FROM Users WHERE login = :login";
+
+	d, e := db.ExecuteDirectly(c, query, map[string]interface{}{"login": "xyz"});
+	if e != nil || len(d) != 1 || d[0][0] != "asdfa" {
+		t.Errorf("Failed to bind from map: %v %s", d, e)
+	}
+
+	d, e = db.ExecuteDirectly(c, query, &namedTest{"xyz", ""});
+	if e != nil || len(d) != 1 || d[0][0] != "asdfa" {
+		t.Errorf("Failed to bind from struct: %v %s", d, e)
+	}
+
+	d, e = db.ExecuteDirectly(c, query, "xyz");
+	if e != nil || len(d) != 1 || d[0][0] != "asdfa" {
+		t.Errorf("Failed to bind by position: %v %s", d, e)
+	}
+
+	_, e = db.ExecuteDirectly(c, query, map[string]interface{}{"user": "xyz"});
+	if e == nil {
+		t.Error("Bound missing parameter")
+	}
+}
+
+// ExecScript(): runs statements in sequence, reports failures
+
+func TestScript(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	conn := c.(*Connection);
+
+	e = conn.ExecScript(
+		"CREATE TABLE Script(x INTEGER);\n" +
+			"-- a comment\n" +
+			"INSERT INTO Script VALUES (1);\n" +
+			"INSERT INTO Script VALUES (2);\n");
+	if e != nil {
+		t.Fatalf("Failed to run script: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c, "SELECT count(*) FROM Script");
+	if e != nil || len(d) != 1 || d[0][0] != int64(2) {
+		t.Errorf("Script didn't insert: %v %s", d, e)
+	}
+
+	e = conn.ExecScript(
+		"INSERT INTO Script VALUES (3);\n" +
+			"INSERT INTO Nowhere VALUES (4);\n");
+	se, ok := e.(*ScriptError);
+	if !ok {
+		t.Fatalf("Expected ScriptError, got %v", e)
+	}
+	if se.Statement() != 2 || se.Line() != 2 || se.Offset() != 31 {
+		t.Errorf("Wrong position for failed statement: %s", se)
+	}
+
+	// Prepare() takes one statement only, trailing comments aside
+	_, e = c.Prepare("SELECT 1; SELECT 2");
+	if e == nil {
+		t.Error("Prepared two statements")
+	}
+	s, e := c.Prepare("SELECT 1; -- done\n");
+	if e != nil {
+		t.Errorf("Failed to prepare with trailing comment: %s", e)
+	} else {
+		s.Close()
+	}
+}
+
+// Transaction(): commits on success, rolls back on errors and panics
+
+func countScript(t *testing.T, c db.Connection) int64 {
+	d, e := db.ExecuteDirectly(c, "SELECT count(*) FROM Script");
+	if e != nil || len(d) != 1 {
+		t.Fatalf("Failed to count: %s", e)
+	}
+	return d[0][0].(int64);
+}
+
+func insertScript(tx *Tx, x int) os.Error {
+	s, e := tx.Prepare("INSERT INTO Script VALUES (?)");
+	if e != nil {
+		return e
+	}
+	defer s.Close();
+	_, e = tx.ExecuteClassic(s, x);
+	return e;
+}
+
+func TestTransaction(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	conn := c.(*Connection);
+	n := countScript(t, c);
+
+	e = conn.Transaction(TxImmediate, func(tx *Tx) os.Error {
+		return insertScript(tx, 10)
+	});
+	if e != nil || countScript(t, c) != n+1 {
+		t.Errorf("Failed to commit: %s", e)
+	}
+
+	e = conn.Transaction(TxDeferred, func(tx *Tx) os.Error {
+		insertScript(tx, 11);
+		return &DriverError{"give up"};
+	});
+	if e == nil || countScript(t, c) != n+1 {
+		t.Errorf("Failed to roll back on error: %s", e)
+	}
+
+	func() {
+		defer func() { recover() }();
+		conn.Transaction(TxExclusive, func(tx *Tx) os.Error {
+			insertScript(tx, 12);
+			panic("give up");
+		});
+	}();
+	if countScript(t, c) != n+1 {
+		t.Error("Failed to roll back on panic")
+	}
+
+	tx, e := conn.Begin(TxDeferred);
+	if e != nil {
+		t.Fatalf("Failed to begin: %s", e)
+	}
+	if e = tx.Commit(); e != nil {
+		t.Errorf("Failed to commit: %s", e)
+	}
+	if e = insertScript(tx, 13); e == nil {
+		t.Error("Used transaction after commit")
+	}
+}
+
+// Savepoint(): nested transactions roll back on their own
+
+func TestSavepoint(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	conn := c.(*Connection);
+	n := countScript(t, c);
+
+	e = conn.Transaction(TxDeferred, func(tx *Tx) os.Error {
+		e := insertScript(tx, 20);
+		if e != nil {
+			return e
+		}
+		e = tx.Transaction("", func(tx *Tx) os.Error {
+			insertScript(tx, 21);
+			return &DriverError{"give up"};
+		});
+		if e == nil {
+			t.Error("Nested transaction didn't fail")
+		}
+		return tx.Transaction("inner", func(tx *Tx) os.Error {
+			return insertScript(tx, 22)
+		});
+	});
+	if e != nil {
+		t.Errorf("Failed to commit: %s", e)
+	}
+	if countScript(t, c) != n+2 {
+		t.Error("Nested rollback undid too much or too little")
+	}
+}
+
+// OpenPool(): reads go to readers, writes to the writer
+
+func TestPool(t *testing.T) {
+	p, e := OpenPool(testName, PoolConfig{Readers: 2});
+	if e != nil {
+		t.Fatalf("Failed to open pool: %s", e)
+	}
+	defer p.Close();
+
+	_, e = p.ExecuteDirectly("INSERT INTO Script VALUES (?)", 30);
+	if e != nil {
+		t.Errorf("Failed to write through pool: %s", e)
+	}
+
+	d, e := p.ExecuteDirectly("SELECT count(*) FROM Script WHERE x = ?", 30);
+	if e != nil || len(d) != 1 || d[0][0] != int64(1) {
+		t.Errorf("Failed to read through pool: %v %s", d, e)
+	}
+
+	r, e := p.Reader();
+	if e != nil {
+		t.Fatalf("Failed to get reader: %s", e)
+	}
+	e = r.exec("INSERT INTO Script VALUES (31)");
+	if e == nil {
+		t.Error("Reader wrote to the database")
+	}
+	p.Release(r);
+
+	for _, q := range []string{"BEGIN", "/* x */ BEGIN", "-- c\nSAVEPOINT s"} {
+		_, e = p.ExecuteDirectly(q);
+		if e == nil {
+			t.Errorf("ExecuteDirectly() started a transaction with %q", q)
+		}
+	}
+
+	w, e := p.Writer();
+	if e != nil {
+		t.Fatalf("Failed to get writer: %s", e)
+	}
+	e = w.exec("BEGIN");
+	if e == nil {
+		e = w.exec("INSERT INTO Script VALUES (32)")
+	}
+	if e != nil {
+		t.Errorf("Failed to write in transaction: %s", e)
+	}
+	p.Release(w);
+
+	d, e = p.ExecuteDirectly("SELECT count(*) FROM Script WHERE x = 32");
+	if e != nil || len(d) != 1 || d[0][0] != int64(0) {
+		t.Errorf("Release() didn't roll back: %v %s", d, e)
+	}
+}
+
+// ExecuteClassicCancel(): runaway queries get interrupted
+
+func TestCancel(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	conn := c.(*Connection);
+	s, e := conn.Prepare(
+		"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) " +
+			"SELECT count(*) FROM c");
+	if e != nil {
+		t.Fatalf("Failed to prepare: %s", e)
+	}
+	defer s.Close();
+
+	_, e = conn.ExecuteClassicCancel(Timeout(100e6), s);
+	se, ok := e.(*SystemError);
+	if !ok || se.Basic() != StatusInterrupt {
+		t.Errorf("Expected interrupt, got %v", e)
+	}
+
+	// fetching with a channel that doesn't fire is just fetching
+	q, e := conn.Prepare("SELECT login FROM Users");
+	if e != nil {
+		t.Fatalf("Failed to prepare: %s", e)
+	}
+	defer q.Close();
+	done := make(chan bool);
+	rs, e := conn.ExecuteClassicCancel(done, q);
+	if e != nil {
+		t.Fatalf("Failed to execute: %s", e)
+	}
+	crs := rs.(*ClassicResultSet);
+	n := 0;
+	for crs.More() {
+		if e = crs.FetchCancel(done).Error(); e != nil {
+			t.Fatalf("Failed to fetch: %s", e)
+		}
+		n++;
+	}
+	if n == 0 || crs.watcher != nil {
+		t.Errorf("Unexpected fetch: %d rows, watcher %v", n, crs.watcher)
+	}
+
+	// once it has fired, the next fetch fails
+	rs, e = conn.ExecuteClassicCancel(done, q);
+	if e != nil {
+		t.Fatalf("Failed to execute: %s", e)
+	}
+	close(done);
+	e = rs.(*ClassicResultSet).FetchCancel(done).Error();
+	se, ok = e.(*SystemError);
+	if !ok || se.Basic() != StatusInterrupt || rs.More() {
+		t.Errorf("Expected interrupt, got %v", e)
+	}
+}
+
+// SetBusyHandler(): gets called while the database is locked
+
+func TestBusy(t *testing.T) {
+	c1, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c1.Close();
+	c2, e := Open(testName + "?" + FlagsURL(OpenReadWrite) + "&" + BusyTimeoutURL(0));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c2.Close();
+
+	tx, e := c1.(*Connection).Begin(TxExclusive);
+	if e != nil {
+		t.Fatalf("Failed to lock database: %s", e)
+	}
+	defer tx.Rollback();
+
+	calls := 0;
+	c2.(*Connection).SetBusyHandler(func(count int) bool {
+		calls++;
+		return count < 2;
+	});
+
+	e = c2.(*Connection).exec("INSERT INTO Script VALUES (40)");
+	se, ok := e.(*SystemError);
+	if !ok || se.Basic() != StatusBusy {
+		t.Errorf("Expected busy, got %v", e)
+	}
+	if calls != 3 {
+		t.Errorf("Busy handler called %d times, expected 3", calls)
+	}
+}
+
+// OpenBlob(): incremental reads and writes
+
+func TestBlob(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	conn := c.(*Connection);
+	e = conn.ExecScript(
+		"CREATE TABLE Blobs(data BLOB);" +
+			"INSERT INTO Blobs(rowid, data) VALUES (1, zeroblob(8));" +
+			"INSERT INTO Blobs(rowid, data) VALUES (2, x'0102');");
+	if e != nil {
+		t.Fatalf("Failed to create blobs: %s", e)
+	}
+
+	b, e := conn.OpenBlob("main", "Blobs", "data", 1, true);
+	if e != nil {
+		t.Fatalf("Failed to open blob: %s", e)
+	}
+	defer b.Close();
+
+	if b.Size() != 8 {
+		t.Errorf("Blob has size %d, expected 8", b.Size())
+	}
+	if _, e = b.WriteAt([]byte("abc"), 6); e == nil {
+		t.Error("Wrote past end of blob")
+	}
+	if n, e := b.WriteAt([]byte("abc"), 2); n != 3 || e != nil {
+		t.Errorf("Failed to write blob: %d %s", n, e)
+	}
+
+	buf := make([]byte, 4);
+	if n, e := b.ReadAt(buf, 2); n != 4 || e != nil || string(buf[0:3]) != "abc" {
+		t.Errorf("Failed to read blob: %d %s %q", n, e, buf)
+	}
+	if n, e := b.ReadAt(buf, 6); n != 2 || e != os.EOF {
+		t.Errorf("Expected short read at end of blob: %d %s", n, e)
+	}
+
+	if e = b.Reopen(2); e != nil || b.Size() != 2 {
+		t.Errorf("Failed to reopen blob: %s", e)
+	}
+}
+
+// RegisterFunc(): Go functions callable from SQL
+
+func TestFunc(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	conn := c.(*Connection);
+	e = conn.RegisterFunc("twice", func(x int64) int64 { return 2 * x }, true);
+	if e != nil {
+		t.Fatalf("Failed to register function: %s", e)
+	}
+	conn.RegisterFunc("fail", func(x interface{}) (interface{}, os.Error) {
+		return x, &DriverError{"failed"}
+	}, false);
+	conn.RegisterFunc("boom", func() string { panic("boom") }, false);
+	conn.RegisterFunc("small", func(x int8) int8 { return x }, false);
+	conn.RegisterFunc("natural", func(x uint) uint { return x }, false);
+
+	d, e := db.ExecuteDirectly(c, "SELECT twice(?)", 21);
+	if e != nil || len(d) != 1 || d[0][0] != int64(42) {
+		t.Errorf("Failed to call function: %v %s", d, e)
+	}
+	if _, e = db.ExecuteDirectly(c, "SELECT fail(1)"); e == nil {
+		t.Error("Error from function ignored")
+	}
+	if _, e = db.ExecuteDirectly(c, "SELECT boom()"); e == nil {
+		t.Error("Panic in function ignored")
+	}
+	if _, e = db.ExecuteDirectly(c, "SELECT small(300)"); e == nil {
+		t.Error("Argument overflow ignored")
+	}
+	if _, e = db.ExecuteDirectly(c, "SELECT natural(-1)"); e == nil {
+		t.Error("Negative argument for unsigned ignored")
+	}
+
+	if e = conn.RegisterFunc("nope", 42, false); e == nil {
+		t.Error("Registered non-function")
+	}
+}
+
+// RegisterAggregate(): Go aggregates and window functions
+
+type sumTest struct {
+	sum int64;
+}
+
+func (self *sumTest) Step(args []interface{}) os.Error {
+	self.sum += args[0].(int64);
+	return nil;
+}
+
+func (self *sumTest) Inverse(args []interface{}) os.Error {
+	self.sum -= args[0].(int64);
+	return nil;
+}
+
+func (self *sumTest) Value() (interface{}, os.Error)	{ return self.sum, nil }
+
+func (self *sumTest) Final() (interface{}, os.Error)	{ return self.sum, nil }
+
+func TestAggregate(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	conn := c.(*Connection);
+	e = conn.RegisterWindow("gosum", 1, func() WindowAggregate { return new(sumTest) }, true);
+	if e != nil {
+		t.Fatalf("Failed to register aggregate: %s", e)
+	}
+	var made int;
+	e = conn.RegisterAggregate("gocount", 0, func() Aggregate {
+		made++;
+		return new(sumTest);
+	}, true);
+	if e != nil || made != 0 {
+		t.Fatalf("Failed to register aggregate: %d made %s", made, e)
+	}
+
+	d, e := db.ExecuteDirectly(c, "SELECT gosum(x), sum(x) FROM Script");
+	if e != nil || len(d) != 1 || d[0][0] != d[0][1] {
+		t.Errorf("Failed to aggregate: %v %s", d, e)
+	}
+
+	d, e = db.ExecuteDirectly(c, "SELECT gosum(x) FROM Script WHERE 0");
+	if e != nil || len(d) != 1 || d[0][0] != int64(0) {
+		t.Errorf("Failed to aggregate nothing: %v %s", d, e)
+	}
+
+	d, e = db.ExecuteDirectly(c,
+		"SELECT gosum(x) OVER w, sum(x) OVER w FROM Script " +
+			"WINDOW w AS (ORDER BY rowid ROWS BETWEEN 1 PRECEDING AND CURRENT ROW)");
+	if e != nil || len(d) == 0 {
+		t.Fatalf("Failed to use window function: %v %s", d, e)
+	}
+	for _, r := range d {
+		if r[0] != r[1] {
+			t.Errorf("Window function got %v, expected %v", r[0], r[1])
+		}
+	}
+}
+
+// RegisterCollation(): Go collations in ORDER BY
+
+type collationTest struct {
+	a, b	string;
+	natural	int;
+	nocase	int;
+}
+
+var collationTests = []collationTest{
+	collationTest{"file9", "file10", -1, 1},
+	collationTest{"file010", "file10", 0, -1},
+	collationTest{"Äpfel", "äpfel", -1, 0},
+	collationTest{"abc", "ab", 1, 1},
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0;
+}
+
+func TestCollation(t *testing.T) {
+	for _, k := range collationTests {
+		if c := sign(Natural(k.a, k.b)); c != k.natural {
+			t.Errorf("Natural(%q, %q) = %d, expected %d", k.a, k.b, c, k.natural)
+		}
+		if c := sign(UnicodeNoCase(k.a, k.b)); c != k.nocase {
+			t.Errorf("UnicodeNoCase(%q, %q) = %d, expected %d", k.a, k.b, c, k.nocase)
+		}
+	}
+
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	e = c.(*Connection).RegisterCollation("natural", Natural);
+	if e != nil {
+		t.Fatalf("Failed to register collation: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c,
+		"SELECT x FROM (SELECT 'file10' AS x UNION SELECT 'file9') " +
+			"ORDER BY x COLLATE natural");
+	if e != nil || len(d) != 2 || d[0][0] != "file9" {
+		t.Errorf("Failed to sort naturally: %v %s", d, e)
+	}
+}
+
+// RegisterModule(): Go virtual tables
+
+// A read-only virtual table holding the squares of 1 to n.
+type squareModule struct{}
+type squareTable struct {
+	n int;
+}
+type squareCursor struct {
+	n, i int;
+}
+
+func (self squareModule) Create(conn *Connection, args []string) (VTab, string, os.Error) {
+	if len(args) != 4 {
+		return nil, "", &DriverError{"squares: Expected one argument!"}
+	}
+	n, e := strconv.Atoi(args[3]);
+	return &squareTable{n}, "CREATE TABLE x(n, square)", e;
+}
+
+func (self squareModule) Connect(conn *Connection, args []string) (VTab, string, os.Error) {
+	return self.Create(conn, args)
+}
+
+func (self *squareTable) BestIndex(info *IndexInfo) os.Error {
+	info.EstimatedCost = float64(self.n);
+	return nil;
+}
+func (self *squareTable) Open() (VTabCursor, os.Error)	{ return &squareCursor{self.n, 0}, nil }
+func (self *squareTable) Disconnect() os.Error		{ return nil }
+func (self *squareTable) Destroy() os.Error		{ return nil }
+
+func (self *squareCursor) Filter(int, string, []interface{}) os.Error {
+	self.i = 1;
+	return nil;
+}
+func (self *squareCursor) Next() os.Error {
+	self.i++;
+	return nil;
+}
+func (self *squareCursor) EOF() bool	{ return self.i > self.n }
+func (self *squareCursor) Column(col int) (interface{}, os.Error) {
+	if col == 0 {
+		return self.i, nil
+	}
+	return self.i * self.i, nil;
+}
+func (self *squareCursor) Rowid() (int64, os.Error)	{ return int64(self.i), nil }
+func (self *squareCursor) Close() os.Error		{ return nil }
+
+func TestVTab(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.RegisterModule("squares", squareModule{});
+	if e != nil {
+		t.Fatalf("Failed to register module: %s", e)
+	}
+
+	e = conn.exec("CREATE VIRTUAL TABLE temp.Squares USING squares(5)");
+	if e != nil {
+		t.Fatalf("Failed to create virtual table: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c, "SELECT sum(square) FROM Squares WHERE n > 2");
+	if e != nil || len(d) != 1 || d[0][0] != int64(9+16+25) {
+		t.Errorf("Failed to query virtual table: %v %s", d, e)
+	}
+
+	e = conn.exec("INSERT INTO Squares VALUES (6, 36)");
+	if e == nil {
+		t.Error("Inserted into read-only virtual table")
+	}
+
+	e = conn.exec("DROP TABLE Squares");
+	if e != nil {
+		t.Errorf("Failed to drop virtual table: %s", e)
+	}
+}
+
+// RegisterTableFunc(): table-valued functions and carray()
+
+func TestTableFunc(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.RegisterTableFunc("series", []string{"value"}, []string{"start", "stop"},
+		func(args []interface{}) (rows [][]interface{}, e os.Error) {
+			start, _ := args[0].(int64);
+			stop, _ := args[1].(int64);
+			for i := start; i <= stop; i++ {
+				rows = append(rows, []interface{}{i})
+			}
+			return;
+		});
+	if e != nil {
+		t.Fatalf("Failed to register table-valued function: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c, "SELECT sum(value) FROM series(1, 4)");
+	if e != nil || len(d) != 1 || d[0][0] != int64(10) {
+		t.Errorf("Failed to call table-valued function: %v %s", d, e)
+	}
+
+	d, e = db.ExecuteDirectly(c,
+		"SELECT value FROM series(1, 10) WHERE value IN carray(?) ORDER BY value",
+		List([]int{3, 5, 42}));
+	if e != nil || len(d) != 2 || d[0][0] != int64(3) || d[1][0] != int64(5) {
+		t.Errorf("Failed to use carray() with []int: %v %s", d, e)
+	}
+
+	d, e = db.ExecuteDirectly(c, "SELECT count(*) FROM carray(?)", List([]string{"a", "b"}));
+	if e != nil || len(d) != 1 || d[0][0] != int64(2) {
+		t.Errorf("Failed to use carray() with []string: %v %s", d, e)
+	}
+
+	// a lone list is a value, not a source of named parameters
+	s, e := c.Prepare("SELECT count(*) FROM carray(?)");
+	if e != nil {
+		t.Fatalf("Failed to prepare: %s", e)
+	}
+	defer s.Close();
+	list := List([]int64{1, 2, 3});
+	for _, p := range []interface{}{list, &list} {
+		rs, e := c.ExecuteClassic(s, p);
+		if e != nil {
+			t.Errorf("Failed to bind single list %T: %s", p, e);
+			continue;
+		}
+		r := rs.Fetch();
+		rs.Close();
+		if r.Error() != nil || r.Data()[0] != int64(3) {
+			t.Errorf("Unexpected result for single list %T: %v %s", p, r.Data(), r.Error())
+		}
+	}
+
+	_, e = db.ExecuteDirectly(c, "SELECT count(*) FROM carray(?)", []int{1, 2});
+	if e == nil {
+		t.Error("Bound bare slice")
+	}
+}
+
+// Backup(): copies a database page by page
+
+func TestBackup(t *testing.T) {
+	const backupName = "backup.db";
+	defer os.Remove(backupName);
+
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	d, e := Open(backupName + "?" + FlagsURL(OpenReadWrite|OpenCreate));
+	if e != nil {
+		t.Fatal("Failed to open backup database")
+	}
+	defer d.Close();
+
+	b, e := c.(*Connection).Backup(d.(*Connection), "main", "main");
+	if e != nil {
+		t.Fatalf("Failed to start backup: %s", e)
+	}
+	if e = b.Run(0, 1000); e == nil {
+		t.Error("Ran backup copying no pages")
+	}
+
+	b, e = c.(*Connection).Backup(d.(*Connection), "main", "main");
+	if e != nil {
+		t.Fatalf("Failed to start backup: %s", e)
+	}
+	done, e := b.Step(1);
+	if e != nil || done || b.PageCount() <= 1 || b.Remaining() != b.PageCount()-1 {
+		t.Errorf("Unexpected first step: %v %d/%d %s", done, b.Remaining(), b.PageCount(), e)
+	}
+	e = b.Run(1, 1000);
+	if e != nil {
+		t.Errorf("Failed to run backup: %s", e)
+	}
+
+	x, e := db.ExecuteDirectly(c, "SELECT count(*) FROM sqlite_master");
+	y, f := db.ExecuteDirectly(d, "SELECT count(*) FROM sqlite_master");
+	if e != nil || f != nil || x[0][0] != y[0][0] {
+		t.Errorf("Backup differs from original: %v %v %s %s", x, y, e, f)
+	}
+}
+
+// SetUpdateChannel(): only committed changes are published
+
+func TestHooks(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.exec("CREATE TEMP TABLE Hooks(x)");
+	if e != nil {
+		t.Fatalf("Failed to create table: %s", e)
+	}
+
+	events := make(chan UpdateEvent, 10);
+	conn.SetUpdateChannel(events);
+	rollbacks := 0;
+	conn.SetRollbackHook(func() { rollbacks++ });
+
+	e = conn.Transaction(TxDeferred, func(tx *Tx) os.Error {
+		e := tx.connection.exec("INSERT INTO Hooks VALUES (1)");
+		if e == nil {
+			e = &DriverError{"roll back"}
+		}
+		return e;
+	});
+	if len(events) != 0 || rollbacks != 1 {
+		t.Errorf("Rolled back changes published: %d events, %d rollbacks", len(events), rollbacks)
+	}
+
+	e = conn.exec("INSERT INTO Hooks VALUES (2)");
+	if e != nil || len(events) != 1 {
+		t.Fatalf("Committed change not published: %d events %s", len(events), e)
+	}
+	if u := <-events; u.Op != RowInsert || u.Database != "temp" || u.Table != "Hooks" {
+		t.Errorf("Unexpected event %v", u)
+	}
+
+	conn.SetCommitHook(func() bool { return false });
+	e = conn.exec("DELETE FROM Hooks");
+	if e == nil || len(events) != 0 || rollbacks != 2 {
+		t.Errorf("Commit hook failed to veto: %d events, %d rollbacks %s", len(events), rollbacks, e)
+	}
+
+	conn.SetCommitHook(nil);
+
+	e = conn.Transaction(TxDeferred, func(tx *Tx) os.Error {
+		e := tx.connection.exec("INSERT INTO Hooks VALUES (3)");
+		if e != nil {
+			return e
+		}
+		// only the savepoint is rolled back
+		_ = tx.Transaction("", func(sp *Tx) os.Error {
+			e := sp.connection.exec("INSERT INTO Hooks VALUES (4)");
+			if e == nil {
+				e = &DriverError{"roll back"}
+			}
+			return e;
+		});
+		return nil;
+	});
+	if len(events) != 1 {
+		t.Fatalf("Savepoint rollback not respected: %d events %s", len(events), e)
+	}
+	<-events;
+
+	// a reader holding the database keeps COMMIT from going through
+	d, e := Open(testName + "?" + FlagsURL(OpenReadWrite) + "&" + BusyTimeoutURL(0));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer d.Close();
+	reader := d.(*Connection);
+
+	e = conn.exec("PRAGMA busy_timeout = 0");
+	if e != nil {
+		t.Fatalf("Failed to set busy timeout: %s", e)
+	}
+	tx, e := conn.Begin(TxDeferred);
+	if e == nil {
+		e = conn.exec("INSERT INTO Script VALUES (50)")
+	}
+	if e != nil {
+		t.Fatalf("Failed to write: %s", e)
+	}
+	e = reader.exec("BEGIN");
+	if e == nil {
+		e = reader.exec("SELECT count(*) FROM Script")
+	}
+	if e != nil {
+		t.Fatalf("Failed to read: %s", e)
+	}
+	e = tx.Commit();
+	if e == nil || len(events) != 0 {
+		t.Errorf("Failed commit published: %d events %s", len(events), e)
+	}
+	reader.exec("ROLLBACK");
+	e = tx.Commit();
+	if e != nil || len(events) != 1 {
+		t.Errorf("Retried commit not published: %d events %s", len(events), e)
+	}
+	conn.exec("DELETE FROM Script WHERE x = 50");
+
+	conn.SetRollbackHook(nil);
+	conn.SetUpdateChannel(nil);
+	if conn.hooks != nil {
+		t.Error("Failed to remove hooks")
+	}
+}
+
+// SetAuthorizer(): denied statements fail to prepare
+
+func TestAuthorizer(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.SetAuthorizer(ReadOnlyPolicy("script"));
+	if e != nil {
+		t.Fatalf("Failed to set authorizer: %s", e)
+	}
+
+	_, e = db.ExecuteDirectly(c, "SELECT count(*) FROM Script");
+	if e != nil {
+		t.Errorf("Failed to read allowed table: %s", e)
+	}
+	_, e = db.ExecuteDirectly(c, "PRAGMA user_version");
+	if e != nil {
+		t.Errorf("Failed to read pragma: %s", e)
+	}
+
+	for _, query := range []string{
+		"SELECT count(*) FROM Users",
+		"INSERT INTO Script VALUES (99)",
+		"PRAGMA user_version = 1",
+		"PRAGMA incremental_vacuum",
+		"PRAGMA wal_checkpoint",
+		"PRAGMA optimize",
+		"SELECT load_extension('nothing')",
+		"ATTACH 'other.db' AS other",
+	} {
+		_, e = conn.Prepare(query);
+		se, ok := e.(*SystemError);
+		if !ok || se.Basic() != StatusAuth {
+			t.Errorf("Expected %q to be denied, got %v", query, e)
+		}
+	}
+
+	e = conn.SetAuthorizer(nil);
+	if e != nil {
+		t.Fatalf("Failed to remove authorizer: %s", e)
+	}
+	_, e = db.ExecuteDirectly(c, "SELECT count(*) FROM Users");
+	if e != nil {
+		t.Errorf("Still denied without authorizer: %s", e)
+	}
+}
+
+// Trace(): statements and profiles are reported
+
+func TestTrace(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	var expanded string;
+	var profiles, rows int;
+	e = conn.Trace(TraceStmt|TraceProfile|TraceRow, func(event interface{}) {
+		switch event := event.(type) {
+		case *StmtEvent:
+			expanded = event.Expanded
+		case *ProfileEvent:
+			if event.Nanoseconds >= 0 && event.SQL == "SELECT ?" {
+				profiles++
+			}
+		case *RowEvent:
+			rows++
+		}
+	});
+	if e != nil {
+		t.Fatalf("Failed to set tracer: %s", e)
+	}
+
+	_, e = db.ExecuteDirectly(c, "SELECT ?", 42);
+	if e != nil || expanded != "SELECT 42" || profiles != 1 || rows != 1 {
+		t.Errorf("Unexpected trace: %q %d profiles %d rows %s", expanded, profiles, rows, e)
+	}
+
+	e = conn.Trace(0, nil);
+	_, _ = db.ExecuteDirectly(c, "SELECT 1");
+	if e != nil || rows != 1 {
+		t.Errorf("Failed to stop tracing: %d rows %s", rows, e)
+	}
+}
+
+// SetProgressHandler(): gets called and can abort statements
+
+func TestProgress(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	const query = "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n LIMIT 100000) SELECT count(*) FROM n";
+
+	calls := 0;
+	conn.SetProgressHandler(1000, func() bool {
+		calls++;
+		return calls >= 10;
+	});
+
+	_, e = db.ExecuteDirectly(c, query);
+	se, ok := e.(*SystemError);
+	if !ok || se.Basic() != StatusInterrupt || calls != 10 {
+		t.Errorf("Expected interrupt after 10 calls, got %d calls %v", calls, e)
+	}
+
+	conn.SetProgressHandler(0, nil);
+	_, e = db.ExecuteDirectly(c, query);
+	if e != nil || calls != 10 {
+		t.Errorf("Failed to remove progress handler: %d calls %s", calls, e)
+	}
+}
+
+// Columns(): names, declared types and origins of results
+
+func TestColumns(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	s, e := c.Prepare("SELECT login AS name, last, 1 + 1 FROM Users");
+	if e != nil {
+		t.Fatalf("Failed to prepare: %s", e)
+	}
+	defer s.Close();
+
+	cols, e := s.(*Statement).Columns();
+	if e != nil || len(cols) != 3 {
+		t.Fatalf("Failed to get columns: %v %s", cols, e)
+	}
+	expected := []ColumnInfo{
+		ColumnInfo{"name", "VARCHAR", "main", "Users", "login", true, true, false},
+		ColumnInfo{"last", "TIMESTAMP", "main", "Users", "last", false, false, false},
+		ColumnInfo{"1 + 1", "", "", "", "", false, false, false},
+	}
+	for i, x := range expected {
+		if cols[i] != x {
+			t.Errorf("Column %d: got %v, expected %v", i, cols[i], x)
+		}
+	}
+
+	rs, e := c.Execute(s);
+	if e != nil {
+		t.Fatalf("Failed to execute: %s", e)
+	}
+	// not closing rs, that needs a running Iter()
+	names := rs.(*ResultSet).Names();
+	types := rs.(*ResultSet).Types();
+	if len(names) != 3 || names[0] != "name" || len(types) != 3 || types[1] != "TIMESTAMP" {
+		t.Errorf("Unexpected names %v and types %v", names, types)
+	}
+}
+
+// ScanStruct(): columns go into matching fields without loss
+
+type scanActive struct {
+	Active	bool	`db:"active"`;
+}
+
+type scanUser struct {
+	Login		string		`db:"login"`;
+	Password	[]byte		`db:"password"`;
+	*scanActive;
+	Last		*time.Time	`db:"last"`;
+}
+
+func TestScanStruct(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	s, e := c.Prepare("SELECT * FROM Users WHERE login IN ('adt', 'phf') ORDER BY login");
+	if e != nil {
+		t.Fatalf("Failed to prepare: %s", e)
+	}
+	defer s.Close();
+
+	rs, e := c.ExecuteClassic(s);
+	if e != nil {
+		t.Fatalf("Failed to execute: %s", e)
+	}
+	var users []scanUser;
+	e = FetchAllInto(rs, &users);
+	rs.Close();
+	if e != nil || len(users) != 2 {
+		t.Fatalf("Failed to fetch into structs: %v %s", users, e)
+	}
+	u := users[0];
+	if u.Login != "adt" || string(u.Password) != "somepassword" || u.scanActive == nil || u.Active || u.Last != nil {
+		t.Errorf("Unexpected user %v", u)
+	}
+
+	rs, e = c.ExecuteClassic(s);
+	if e != nil {
+		t.Fatalf("Failed to execute: %s", e)
+	}
+	var wrong struct {
+		Login	int	`db:"login"`;
+	}
+	e = ScanStruct(rs.Fetch(), &wrong);
+	rs.Close();
+	if _, ok := e.(*DriverError); !ok {
+		t.Errorf("Scanned text into int: %v", e)
+	}
+
+	rs, e = c.ExecuteClassic(s);
+	if e != nil {
+		t.Fatalf("Failed to execute: %s", e)
+	}
+	var partial struct {
+		Login string;
+	}
+	e = ScanStruct(rs.Fetch(), &partial);
+	rs.Close();
+	if um, ok := e.(*UnmatchedColumnsError); !ok || len(um.Columns()) != 3 || partial.Login != "adt" {
+		t.Errorf("Expected three unmatched columns, got %v %v", partial, e)
+	}
+
+	var numbers struct {
+		X	float64;
+		Y	float32;
+	}
+	for _, query := range []string{
+		"SELECT 9007199254740993 AS x",
+		"SELECT 16777217 AS y",
+		"SELECT 0.1 AS y",
+		"SELECT 1 AS x, 2 AS X",
+	} {
+		d, e := c.Prepare(query);
+		if e != nil {
+			t.Fatalf("Failed to prepare: %s", e)
+		}
+		rs, e = c.ExecuteClassic(d);
+		if e != nil {
+			t.Fatalf("Failed to execute: %s", e)
+		}
+		e = ScanStruct(rs.Fetch(), &numbers);
+		rs.Close();
+		d.Close();
+		if _, ok := e.(*DriverError); !ok {
+			t.Errorf("Scanned %q without complaint: %v", query, e)
+		}
+	}
+}
+
+// InsertStruct(): rows from structs, rowids filled in
+
+type thing struct {
+	Id	int64	`db:"id,autoincrement"`;
+	Name	string	`db:"name"`;
+	Note	string	`db:"note,omitempty"`;
+	Created	string	`db:"created,readonly"`;
+}
+
+func TestInsertStruct(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.exec("CREATE TABLE Things(id INTEGER PRIMARY KEY AUTOINCREMENT, " +
+		"name TEXT NOT NULL, note TEXT DEFAULT 'none', created TEXT DEFAULT 'today')");
+	if e != nil {
+		t.Fatalf("Failed to create table: %s", e)
+	}
+
+	a := &thing{Name: "a"};
+	b := &thing{Name: "b", Note: "second"};
+	for _, x := range []*thing{a, b} {
+		e = InsertStruct(conn, "Things", x);
+		if e != nil {
+			t.Fatalf("Failed to insert %v: %s", x, e)
+		}
+	}
+	if a.Id == 0 || b.Id != a.Id+1 {
+		t.Errorf("Rowids not filled in: %d %d", a.Id, b.Id)
+	}
+
+	a.Name = "A";
+	e = UpdateStruct(conn, "Things", a);
+	if e != nil {
+		t.Errorf("Failed to update: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c, "SELECT name, note, created FROM Things ORDER BY id");
+	if e != nil || len(d) != 2 || d[0][0] != "A" || d[0][1] != "none" || d[1][1] != "second" || d[1][2] != "today" {
+		t.Errorf("Unexpected rows: %v %s", d, e)
+	}
+
+	e = UpdateStruct(conn, "Things", &thing{Id: 99, Name: "x"});
+	if e == nil {
+		t.Error("Updated missing row")
+	}
+	e = UpdateStruct(conn, "Things", a, "nonexistent");
+	if e == nil {
+		t.Error("Updated with missing key field")
+	}
+
+	e = conn.exec("INSERT INTO Things(id, name) VALUES (1000, 'big')");
+	if e != nil {
+		t.Fatalf("Failed to insert: %s", e)
+	}
+	var small struct {
+		Id	int8	`db:"id,autoincrement"`;
+		Name	string	`db:"name"`;
+	}
+	small.Name = "small";
+	e = InsertStruct(conn, "Things", &small);
+	if e == nil || small.Id != 0 {
+		t.Errorf("Stored rowid in field too small: %d %v", small.Id, e)
+	}
+}
+
+// SetStatementCacheSize(): prepared statements are reused
+
+func TestStatementCache(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	const query = "SELECT login FROM Users ORDER BY login";
+	for i := 0; i < 3; i++ {
+		_, e = db.ExecuteDirectly(c, query)
+	}
+	stats := conn.StatementCacheStats();
+	if e != nil || stats.Misses != 1 || stats.Hits != 2 || stats.Size != 1 {
+		t.Errorf("Unexpected cache stats %v %s", stats, e)
+	}
+
+	// a statement closed with open results must not be
+	// handed out again until the results are done
+	s, e := c.Prepare(query);
+	if e != nil {
+		t.Fatalf("Failed to prepare: %s", e)
+	}
+	rs, e := c.ExecuteClassic(s);
+	if e != nil {
+		t.Fatalf("Failed to execute: %s", e)
+	}
+	first := rs.Fetch();
+	s.Close();
+	d, e := db.ExecuteDirectly(c, query);
+	if e != nil || len(d) < 2 {
+		t.Fatalf("Failed to execute while results open: %v %s", d, e)
+	}
+	rows := [][]interface{}{first.Data()};
+	for rs.More() {
+		rows = append(rows, rs.Fetch().Data())
+	}
+	if len(rows) != len(d) || rows[0][0] != d[0][0] || rows[1][0] != d[1][0] {
+		t.Errorf("Open results disturbed: %v vs %v", rows, d)
+	}
+
+	// statements prepared before the authorizer came along
+	// must not slip past it through the cache
+	s, e = c.Prepare("SELECT count(*) FROM Users");
+	if e != nil {
+		t.Fatalf("Failed to prepare: %s", e)
+	}
+	e = conn.SetAuthorizer(ReadOnlyPolicy("script"));
+	if e != nil {
+		t.Fatalf("Failed to set authorizer: %s", e)
+	}
+	s.Close();
+	_, e = c.Prepare("SELECT count(*) FROM Users");
+	if se, ok := e.(*SystemError); !ok || se.Basic() != StatusAuth {
+		t.Errorf("Cached statement bypassed authorizer: %v", e)
+	}
+	conn.SetAuthorizer(nil);
+
+	// SetAuthorizer() emptied the cache without evicting
+	conn.SetStatementCacheSize(1);
+	before := conn.StatementCacheStats().Evictions;
+	for _, q := range []string{"SELECT 1", "SELECT 2", "SELECT 3"} {
+		_, e = db.ExecuteDirectly(c, q)
+	}
+	stats = conn.StatementCacheStats();
+	if e != nil || stats.Size != 1 || stats.Capacity != 1 || stats.Evictions-before != 2 {
+		t.Errorf("Unexpected cache stats after shrinking %v %s", stats, e)
+	}
+
+	conn.SetStatementCacheSize(0);
+	_, e = db.ExecuteDirectly(c, query);
+	stats = conn.StatementCacheStats();
+	if e != nil || stats.Size != 0 {
+		t.Errorf("Cache not disabled: %v %s", stats, e)
+	}
+
+	// without the cache, closing waits for the results as well
+	s, e = c.Prepare(query);
+	if e != nil {
+		t.Fatalf("Failed to prepare: %s", e)
+	}
+	rs, e = c.ExecuteClassic(s);
+	if e != nil {
+		t.Fatalf("Failed to execute: %s", e)
+	}
+	s.Close();
+	n := 0;
+	for rs.More() {
+		if e = rs.Fetch().Error(); e != nil {
+			t.Fatalf("Failed to fetch after Close(): %s", e)
+		}
+		n++;
+	}
+	if n != len(d) {
+		t.Errorf("Expected %d results after Close(), got %d", len(d), n)
+	}
+	crs := rs.(*ClassicResultSet);
+	if names := crs.Names(); len(names) != 1 || names[0] != "login" {
+		t.Errorf("Lost names with the statement: %v", names)
+	}
+	if _, e = crs.Columns(); e == nil {
+		t.Error("Got columns of finalized statement")
+	}
+}
+
 // clean up: remove the test database
 
 func TestDummy(t *testing.T)	{ os.Remove(testName) }
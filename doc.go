@@ -8,21 +8,45 @@
 // the missing details. Sorry, our documentation is focused
 // on driver details, not on SQLite in general.
 //
+// The driver needs SQLite 3.25.0 or later, we link against
+// sqlite3_create_window_function() for window aggregates (and
+// sqlite3_bind_pointer() from 3.20.0 to pass lists to carray()).
+//
 // Restrictions on Types:
 //
-// For now, we treat *all* values as strings. This is less of
-// an issue for SQLite since it's typed dynamically anyway.
-// Accepting/returning appropriate Go types is a high priority
-// goal though.
+// Parameters are bound according to their Go type: integers
+// become INTEGER, floats become REAL, strings become TEXT, byte
+// slices become BLOB and nil (as well as nil pointers) becomes
+// NULL. Booleans are stored as 0 or 1, and time values as TEXT
+// in the layout given to SetTimeFormat() (DefaultTimeFormat
+// unless changed). Values of other types are rejected.
+//
+// Other slices (say []int64 or []string) are rejected as well,
+// but wrapped with List() they are bound as a list for the
+// built-in carray() table-valued function, so a single "?" takes
+// any number of values in "WHERE id IN carray(?)". Lists look
+// like NULL anywhere else.
+//
+// Results are returned according to the storage class SQLite
+// reports for each value: int64 for INTEGER, float64 for REAL,
+// string for TEXT, []byte for BLOB and nil for NULL. Note that
+// the declared type of a column does *not* matter here, see
+// http://www.sqlite.org/datatype3.html for details.
 //
 // Binding Query Parameters:
 //
 // SQL queries can contain "?" parameter slots that are bound
-// to values in Execute(). SQLite has more variations that we
-// don't support for now: they would make the API more complex
-// for very little gain. Parameter slots are matched to values
+// to values in Execute(). Parameter slots are matched to values
 // in order of appearance.
 //
+// Queries can also contain named parameters of the form ":name",
+// "@name" or "$name". Passing a single map with string keys or
+// a single struct (or pointer to struct) to Execute() binds them
+// by name: the prefix is stripped and the rest is looked up as a
+// map key or as a struct field. Struct fields are named by their
+// `db:"name"` tag if they have one, by their Go name otherwise.
+// Named parameters can still be bound by position as well.
+//
 // Concurrency:
 //
 // We still need to address concurrency issues in detail, for
@@ -30,6 +54,17 @@
 // (see http://www.sqlite.org/threadsafe.html for details).
 //
 //
+// The database/sql Package:
+//
+// We don't provide a database/sql driver (yet). The Go release
+// this driver is written against predates database/sql and its
+// driver interfaces (not to mention context.Context), and they
+// can't be implemented on top of os.Error based code anyway.
+// Once we move to a release that has them, a driver.Driver on
+// top of Connection, Statement and ClassicResultSet will be
+// registered as "sqlite3", accepting the same URLs as Open().
+//
+//
 // Low-Level API:
 //
 // The file low.go contains the low-level API for SQLite. The
@@ -38,4 +73,10 @@
 // that the technical reason for the low-level API is that cgo
 // can't process multiple files at once (a factoid that really
 // doesn't have any bearing whatsoever on applications).
+//
+// Callbacks from SQLite into Go (busy handlers and the like)
+// are the exception: they need exported Go functions, which cgo
+// only allows in files without C definitions. So callback.go
+// has those functions and callback.c has the C trampolines that
+// call them.
 package sqlite3
@@ -4,7 +4,11 @@
 
 package sqlite3
 
-import "fmt"
+import (
+	"fmt";
+	"os";
+	"strings";
+)
 
 // Error in the database driver itself, *not* the database
 // system we talk to.
@@ -105,3 +109,46 @@ func (self SystemError) Basic() int	{ return self.basic }
 // together from various bits and pieces on top
 // of basic status codes.
 func (self SystemError) Extended() int	{ return self.extended }
+
+// Error while running a script with ExecScript(). Tells
+// us which statement failed and where it starts.
+type ScriptError struct {
+	statement	int;
+	offset		int;
+	line		int;
+	cause		os.Error;
+}
+
+// Textual description of the error.
+// Implements os.Error interface.
+func (self ScriptError) String() string {
+	return fmt.Sprintf("statement %d (line %d): %s", self.statement, self.line, self.cause)
+}
+
+// Number of the failed statement, counting from 1.
+func (self ScriptError) Statement() int	{ return self.statement }
+
+// Byte offset of the failed statement in the script.
+func (self ScriptError) Offset() int	{ return self.offset }
+
+// Line the failed statement starts on, counting from 1.
+func (self ScriptError) Line() int	{ return self.line }
+
+// The error the failed statement ran into, usually
+// a SystemError.
+func (self ScriptError) Cause() os.Error	{ return self.cause }
+
+// Columns without a matching struct field, see ScanStruct().
+// The fields for all other columns are filled in anyway.
+type UnmatchedColumnsError struct {
+	columns []string;
+}
+
+// Textual description of the error.
+// Implements os.Error interface.
+func (self UnmatchedColumnsError) String() string {
+	return fmt.Sprintf("no struct field for column(s) %s", strings.Join(self.columns, ", "))
+}
+
+// Names of the unmatched columns.
+func (self UnmatchedColumnsError) Columns() []string	{ return self.columns }
@@ -0,0 +1,202 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// SQL functions implemented in Go. Arguments are converted to the
+// parameter types of the Go function the way SQLite converts
+// values (see http://www.sqlite.org/c3ref/value_blob.html), so
+// a string parameter gets the text of whatever was passed. Use
+// an interface{} parameter to get the value as it is, typed as
+// described for results in the package documentation. Results
+// are converted just like parameters for Execute().
+
+import (
+	"fmt";
+	"os";
+	"reflect";
+)
+
+var errorType = reflect.TypeOf((*os.Error)(nil)).Elem()
+
+// A Go function registered with SQLite.
+type function struct {
+	connection	*Connection;
+	fn		reflect.Value;
+}
+
+// Can we convert SQL values to parameters of this type?
+func argumentType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	case reflect.Interface:
+		return t.NumMethod() == 0
+	}
+	return false;
+}
+
+// Make fn available as a scalar SQL function called name. The
+// function must take parameters of the types listed for results
+// in the package documentation (or other integer, float, string,
+// bool, []byte or interface{} types), and return one result or a
+// result and an os.Error. An error or panic makes the SQL statement
+// calling the function fail. Set deterministic if fn always returns
+// the same result for the same arguments; SQLite then allows it in
+// indexes and optimizes calls.
+func (self *Connection) RegisterFunc(name string, fn interface{}, deterministic bool) (error os.Error) {
+	f := new(function);
+	f.connection = self;
+	f.fn = reflect.ValueOf(fn);
+
+	if f.fn.Kind() != reflect.Func {
+		error = &DriverError{"RegisterFunc: Not a function!"};
+		return;
+	}
+
+	t := f.fn.Type();
+	if t.IsVariadic() {
+		error = &DriverError{"RegisterFunc: Variadic functions not supported!"};
+		return;
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		if !argumentType(t.In(i)) {
+			error = &DriverError{fmt.Sprintf("RegisterFunc: Can't pass SQL values as %s!", t.In(i))};
+			return;
+		}
+	}
+	switch {
+	case t.NumOut() == 1 && t.Out(0) != errorType:
+	case t.NumOut() == 2 && t.Out(1) == errorType:
+	default:
+		error = &DriverError{"RegisterFunc: Function must return a value and optionally an os.Error!"};
+		return;
+	}
+
+	flags := sqlUTF8;
+	if deterministic {
+		flags |= sqlDeterministic
+	}
+
+	// SQLite unregisters the handle if this fails
+	rc := self.handle.sqlCreateFunction(name, t.NumIn(), flags, register(f));
+	if rc != StatusOk {
+		error = self.error()
+	}
+	return;
+}
+
+// Call the Go function with the given arguments and set the
+// result in ctx.
+func (self *function) call(ctx *sqlContext, args []sqlValue) {
+	t := self.fn.Type();
+	in := make([]reflect.Value, len(args));
+	for i := range args {
+		var ok bool;
+		in[i], ok = args[i].convert(t.In(i));
+		if !ok {
+			ctx.sqlResultError(fmt.Sprintf("Argument %d out of range for %s!", i+1, t.In(i)));
+			return;
+		}
+	}
+
+	out := self.fn.Call(in);
+	if len(out) == 2 && !out[1].IsNil() {
+		ctx.sqlResultError(out[1].Interface().(os.Error).String());
+		return;
+	}
+
+	ctx.result(self.connection, out[0].Interface());
+}
+
+// Set the result of an SQL function, converting value to a type
+// SQLite understands with native().
+func (self *sqlContext) result(conn *Connection, value interface{}) {
+	v, error := conn.native(value);
+	if error != nil {
+		self.sqlResultError(error.String());
+		return;
+	}
+
+	switch v := v.(type) {
+	case nil:
+		self.sqlResultNull();
+	case int64:
+		self.sqlResultInt64(v);
+	case float64:
+		self.sqlResultDouble(v);
+	case string:
+		self.sqlResultText(v);
+	case []byte:
+		self.sqlResultBlob(v);
+	case []interface{}:
+		self.sqlResultError("Can't return a list of values!");
+	}
+}
+
+// The value typed according to its storage class, just like
+// Statement.column().
+func (self *sqlValue) value() (value interface{}) {
+	switch self.sqlType() {
+	case sqlIntegerType:
+		value = self.sqlInt64();
+	case sqlFloatType:
+		value = self.sqlDouble();
+	case sqlTextType:
+		value = self.sqlText();
+	case sqlBlobType:
+		value = self.sqlBlob();
+	case sqlNullType:
+		// slices bound as parameters look like NULL to
+		// SQL, but we know better
+		if h := self.sqlPointer(); h != nil {
+			value = lookup(h)
+		}
+	default:
+		sqlPanic("unknown value type");
+	}
+	return;
+}
+
+// The value converted to type t, which must be acceptable to
+// argumentType(). Not ok if the value doesn't fit into t.
+func (self *sqlValue) convert(t reflect.Type) (r reflect.Value, ok bool) {
+	r = reflect.New(t).Elem();
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v := self.sqlInt64();
+		if r.OverflowInt(v) {
+			return
+		}
+		r.SetInt(v);
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v := self.sqlInt64();
+		if v < 0 || r.OverflowUint(uint64(v)) {
+			return
+		}
+		r.SetUint(uint64(v));
+	case reflect.Float32, reflect.Float64:
+		v := self.sqlDouble();
+		if r.OverflowFloat(v) {
+			return
+		}
+		r.SetFloat(v);
+	case reflect.String:
+		r.SetString(self.sqlText());
+	case reflect.Bool:
+		r.SetBool(self.sqlInt64() != 0);
+	case reflect.Slice:
+		r.SetBytes(self.sqlBlob());
+	case reflect.Interface:
+		if v := self.value(); v != nil {
+			r.Set(reflect.ValueOf(v))
+		}
+	}
+	ok = true;
+	return;
+}
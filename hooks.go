@@ -0,0 +1,237 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Update, commit and rollback hooks, see
+// http://www.sqlite.org/c3ref/update_hook.html and
+// http://www.sqlite.org/c3ref/commit_hook.html for details.
+//
+// SQLite reports changes to rows as they happen, long before we
+// know whether they'll stick. So we buffer them until the commit
+// went through and publish them then, or throw them away when the
+// rollback hook runs. The commit hook runs before the commit is
+// attempted, which can still fail (say with StatusBusy), so we
+// only publish once the step that ran it succeeded and SQLite is
+// back in autocommit mode. SQLite doesn't tell us about ROLLBACK
+// TO a savepoint; Tx.Rollback() drops the changes undone that way,
+// but if you run ROLLBACK TO yourself they are published anyway
+// once the transaction commits. Changes to WITHOUT ROWID tables
+// aren't reported at all.
+//
+// All hooks run while SQLite is in the middle of a statement, so
+// they must not use the connection. They also shouldn't take long,
+// the connection is blocked until they return.
+//
+// SQLite calls the hooks with its own mutex held while we look at
+// the same state from Go, so the hooks have a lock of their own;
+// the connection's lock protects which hooks it has. We never call
+// user code with either lock held.
+
+import "sync"
+
+// A change to a single row.
+type UpdateEvent struct {
+	Op		int;	// RowInsert, RowUpdate or RowDelete
+	Database	string;	// "main", "temp" or an attached name
+	Table		string;
+	Rowid		int64;
+}
+
+// The hooks of a connection, registered with SQLite as a single
+// handle.
+type hooks struct {
+	lock		sync.Mutex;	// protects everything below
+	pending		[]UpdateEvent;	// changes not yet committed
+	committing	bool;	// commit hook ran, commit not done yet
+	handler		func(UpdateEvent);
+	channel		chan<- UpdateEvent;
+	dropped		int64;	// events the channel had no room for
+	onCommit	func() bool;
+	onRollback	func();
+}
+
+// Call handler for each committed change, in order. A nil
+// handler stops the calls.
+func (self *Connection) SetUpdateHandler(handler func(UpdateEvent)) {
+	self.setHooks(func(h *hooks) { h.handler = handler })
+}
+
+// Send each committed change on channel, in order. We never
+// block: if the channel is full, the event is dropped and counted
+// (see DroppedUpdates()), so make sure the buffer is big enough for
+// the largest transaction you expect. A nil channel stops sending.
+func (self *Connection) SetUpdateChannel(channel chan<- UpdateEvent) {
+	self.setHooks(func(h *hooks) { h.channel = channel })
+}
+
+// Number of events dropped because the update channel was full.
+func (self *Connection) DroppedUpdates() int64 {
+	h := self.currentHooks();
+	if h == nil {
+		return 0
+	}
+	h.lock.Lock();
+	defer h.lock.Unlock();
+	return h.dropped;
+}
+
+// Call hook whenever a transaction is about to commit. If it
+// returns false, the transaction is rolled back instead. A nil
+// hook removes the current one.
+func (self *Connection) SetCommitHook(hook func() bool) {
+	self.setHooks(func(h *hooks) { h.onCommit = hook })
+}
+
+// Call hook whenever a transaction is rolled back, but not for
+// ROLLBACK TO a savepoint. A nil hook removes the current one.
+func (self *Connection) SetRollbackHook(hook func()) {
+	self.setHooks(func(h *hooks) { h.onRollback = hook })
+}
+
+func (self *Connection) currentHooks() *hooks {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	return self.hooks;
+}
+
+// Change the connection's hooks with set, installing them with
+// SQLite if we didn't have any so far and removing them if we
+// have none left.
+func (self *Connection) setHooks(set func(*hooks)) {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+
+	if self.hooks == nil {
+		h := new(hooks);
+		handle := register(h);
+		self.handle.sqlSetHooks(handle);
+		self.swapCallback("hooks", handle);
+		self.hooks = h;
+	}
+
+	h := self.hooks;
+	h.lock.Lock();
+	set(h);
+	empty := h.handler == nil && h.channel == nil && h.onCommit == nil && h.onRollback == nil;
+	h.lock.Unlock();
+
+	if empty {
+		self.handle.sqlSetHooks(nil);
+		self.swapCallback("hooks", nil);
+		self.hooks = nil;
+	}
+}
+
+func (self *hooks) update(op int, database, table string, rowid int64) {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	if self.handler == nil && self.channel == nil {
+		return
+	}
+	self.pending = append(self.pending, UpdateEvent{op, database, table, rowid});
+}
+
+// Returns false to turn the commit into a rollback. Otherwise we
+// wait for stepped() to tell us whether the commit worked.
+func (self *hooks) commit() bool {
+	self.lock.Lock();
+	onCommit := self.onCommit;
+	self.lock.Unlock();
+
+	if onCommit != nil && !onCommit() {
+		// the rollback hook gets rid of pending
+		return false
+	}
+
+	self.lock.Lock();
+	self.committing = true;
+	self.lock.Unlock();
+	return true;
+}
+
+func (self *hooks) publish() {
+	self.lock.Lock();
+	pending := self.pending;
+	self.pending = nil;
+	handler := self.handler;
+	channel := self.channel;
+	self.lock.Unlock();
+
+	var dropped int64;
+	for _, e := range pending {
+		if handler != nil {
+			handler(e)
+		}
+		if channel != nil {
+			select {
+			case channel <- e:
+			default:
+				dropped++
+			}
+		}
+	}
+
+	if dropped > 0 {
+		self.lock.Lock();
+		self.dropped += dropped;
+		self.lock.Unlock();
+	}
+}
+
+// Called after every step, ok if it succeeded. If the commit hook
+// ran during the step, the commit went through if the step did
+// and we're out of the transaction; otherwise the transaction is
+// still open and the changes stay pending.
+func (self *Connection) stepped(ok bool) {
+	h := self.currentHooks();
+	if h == nil {
+		return
+	}
+
+	h.lock.Lock();
+	committing := h.committing;
+	h.committing = false;
+	h.lock.Unlock();
+
+	if committing && ok && self.handle.sqlGetAutocommit() {
+		h.publish()
+	}
+}
+
+// Number of pending changes, for savepoints to come back to.
+func (self *Connection) changeMark() int {
+	h := self.currentHooks();
+	if h == nil {
+		return 0
+	}
+	h.lock.Lock();
+	defer h.lock.Unlock();
+	return len(h.pending);
+}
+
+// Drop pending changes after mark, they were rolled back.
+func (self *Connection) dropChanges(mark int) {
+	h := self.currentHooks();
+	if h == nil {
+		return
+	}
+	h.lock.Lock();
+	defer h.lock.Unlock();
+	if len(h.pending) > mark {
+		h.pending = h.pending[0:mark]
+	}
+}
+
+func (self *hooks) rollback() {
+	self.lock.Lock();
+	self.pending = nil;
+	self.committing = false;
+	onRollback := self.onRollback;
+	self.lock.Unlock();
+
+	if onRollback != nil {
+		onRollback()
+	}
+}
@@ -28,6 +28,58 @@ int wsq_bind_text(sqlite3_stmt *statement, int i, const char* text, int n)
 {
 	return sqlite3_bind_text(statement, i, text, n, SQLITE_TRANSIENT);
 }
+int wsq_bind_blob(sqlite3_stmt *statement, int i, const void* blob, int n)
+{
+	return sqlite3_bind_blob(statement, i, blob, n, SQLITE_TRANSIENT);
+}
+
+// needed for the same reason as wsq_column_text()
+const char *wsq_value_text(sqlite3_value *value)
+{
+	return (const char *) sqlite3_value_text(value);
+}
+
+// needed for the same reason as wsq_bind_text()
+void wsq_result_text(sqlite3_context *context, const char* text, int n)
+{
+	sqlite3_result_text(context, text, n, SQLITE_TRANSIENT);
+}
+void wsq_result_blob(sqlite3_context *context, const void* blob, int n)
+{
+	sqlite3_result_blob(context, blob, n, SQLITE_TRANSIENT);
+}
+
+// trampolines for callbacks into Go, defined in callback.c
+int wsq_busy_handler(sqlite3 *db, void *handle);
+int wsq_create_function(sqlite3 *db, const char *name, int nargs, int flags, void *handle);
+int wsq_create_aggregate(sqlite3 *db, const char *name, int nargs, int flags, void *handle, int window);
+int wsq_create_collation(sqlite3 *db, const char *name, void *handle);
+int wsq_create_module(sqlite3 *db, const char *name, void *handle, int eponymous);
+void wsq_set_hooks(sqlite3 *db, void *handle);
+int wsq_set_authorizer(sqlite3 *db, void *handle);
+int wsq_trace(sqlite3 *db, int mask, void *handle);
+void wsq_progress_handler(sqlite3 *db, int ops, void *handle);
+void wsq_release_trampoline(void *handle);
+
+// Go values bound with sqlite3_bind_pointer() are registry handles
+// tagged with this type; SQLite only hands them back to us if we
+// ask for the same type, so other extensions never see them.
+// The handle is released once SQLite is done with the binding.
+int wsq_bind_pointer(sqlite3_stmt *statement, int i, void *handle)
+{
+	return sqlite3_bind_pointer(statement, i, handle, "carray", wsq_release_trampoline);
+}
+void *wsq_value_pointer(sqlite3_value *value)
+{
+	return sqlite3_value_pointer(value, "carray");
+}
+
+// needed to work around the ... argument of sqlite3_mprintf();
+// SQLite wants some strings allocated with sqlite3_malloc()
+char *wsq_strdup(const char *s)
+{
+	return sqlite3_mprintf("%s", s);
+}
 
 // needed to work around the ... argument of sqlite3_config(); if
 // we ever require an option with parameters, we'll have to add more
@@ -50,6 +102,83 @@ const (
 	sqlNullType;
 )
 
+// Text encoding and other flags for sqlite3_create_function()
+// and friends.
+const (
+	sqlUTF8		= int(C.SQLITE_UTF8);
+	sqlDeterministic	= int(C.SQLITE_DETERMINISTIC);
+)
+
+// Operators for IndexConstraint.Op, see VTab.BestIndex().
+const (
+	IndexConstraintEq	= int(C.SQLITE_INDEX_CONSTRAINT_EQ);
+	IndexConstraintGt	= int(C.SQLITE_INDEX_CONSTRAINT_GT);
+	IndexConstraintLe	= int(C.SQLITE_INDEX_CONSTRAINT_LE);
+	IndexConstraintLt	= int(C.SQLITE_INDEX_CONSTRAINT_LT);
+	IndexConstraintGe	= int(C.SQLITE_INDEX_CONSTRAINT_GE);
+	IndexConstraintMatch	= int(C.SQLITE_INDEX_CONSTRAINT_MATCH);
+)
+
+// Kinds of changes in UpdateEvent.Op.
+const (
+	RowInsert	= int(C.SQLITE_INSERT);
+	RowUpdate	= int(C.SQLITE_UPDATE);
+	RowDelete	= int(C.SQLITE_DELETE);
+)
+
+// Actions checked by an Authorizer. The comments say what the
+// two action-specific arguments are.
+const (
+	ActionCreateIndex	= int(C.SQLITE_CREATE_INDEX);	// index, table
+	ActionCreateTable	= int(C.SQLITE_CREATE_TABLE);	// table, -
+	ActionCreateTempIndex	= int(C.SQLITE_CREATE_TEMP_INDEX);	// index, table
+	ActionCreateTempTable	= int(C.SQLITE_CREATE_TEMP_TABLE);	// table, -
+	ActionCreateTempTrigger	= int(C.SQLITE_CREATE_TEMP_TRIGGER);	// trigger, table
+	ActionCreateTempView	= int(C.SQLITE_CREATE_TEMP_VIEW);	// view, -
+	ActionCreateTrigger	= int(C.SQLITE_CREATE_TRIGGER);	// trigger, table
+	ActionCreateView	= int(C.SQLITE_CREATE_VIEW);	// view, -
+	ActionDelete		= int(C.SQLITE_DELETE);	// table, -
+	ActionDropIndex		= int(C.SQLITE_DROP_INDEX);	// index, table
+	ActionDropTable		= int(C.SQLITE_DROP_TABLE);	// table, -
+	ActionDropTempIndex	= int(C.SQLITE_DROP_TEMP_INDEX);	// index, table
+	ActionDropTempTable	= int(C.SQLITE_DROP_TEMP_TABLE);	// table, -
+	ActionDropTempTrigger	= int(C.SQLITE_DROP_TEMP_TRIGGER);	// trigger, table
+	ActionDropTempView	= int(C.SQLITE_DROP_TEMP_VIEW);	// view, -
+	ActionDropTrigger	= int(C.SQLITE_DROP_TRIGGER);	// trigger, table
+	ActionDropView		= int(C.SQLITE_DROP_VIEW);	// view, -
+	ActionInsert		= int(C.SQLITE_INSERT);	// table, -
+	ActionPragma		= int(C.SQLITE_PRAGMA);	// pragma, argument
+	ActionRead		= int(C.SQLITE_READ);	// table, column
+	ActionSelect		= int(C.SQLITE_SELECT);	// -, -
+	ActionTransaction	= int(C.SQLITE_TRANSACTION);	// operation, -
+	ActionUpdate		= int(C.SQLITE_UPDATE);	// table, column
+	ActionAttach		= int(C.SQLITE_ATTACH);	// file, -
+	ActionDetach		= int(C.SQLITE_DETACH);	// database, -
+	ActionAlterTable	= int(C.SQLITE_ALTER_TABLE);	// database, table
+	ActionReindex		= int(C.SQLITE_REINDEX);	// index, -
+	ActionAnalyze		= int(C.SQLITE_ANALYZE);	// table, -
+	ActionCreateVTable	= int(C.SQLITE_CREATE_VTABLE);	// table, module
+	ActionDropVTable	= int(C.SQLITE_DROP_VTABLE);	// table, module
+	ActionFunction		= int(C.SQLITE_FUNCTION);	// -, function
+	ActionSavepoint		= int(C.SQLITE_SAVEPOINT);	// operation, savepoint
+	ActionRecursive		= int(C.SQLITE_RECURSIVE);	// -, -
+)
+
+// Kinds of events for Trace(), or'd together.
+const (
+	TraceStmt	= int(C.SQLITE_TRACE_STMT);
+	TraceProfile	= int(C.SQLITE_TRACE_PROFILE);
+	TraceRow	= int(C.SQLITE_TRACE_ROW);
+	TraceClose	= int(C.SQLITE_TRACE_CLOSE);
+)
+
+// What an Authorizer can decide.
+const (
+	AuthAllow	= int(C.SQLITE_OK);	// go ahead
+	AuthDeny	= int(C.SQLITE_DENY);	// fail the statement with StatusAuth
+	AuthIgnore	= int(C.SQLITE_IGNORE);	// read NULL, skip the change or the DROP
+)
+
 // Constants for sqlite3_config() used only internally.
 // In fact only *one* is used. See SQLite documentation
 // for details.
@@ -122,6 +251,18 @@ type sqlBlob struct {
 	handle *C.sqlite3_blob;
 }
 
+type sqlContext struct {
+	handle *C.sqlite3_context;
+}
+
+type sqlIndexInfo struct {
+	handle *C.sqlite3_index_info;
+}
+
+type sqlBackup struct {
+	handle *C.sqlite3_backup;
+}
+
 // Wrappers around the most important SQLite functions.
 
 func sqlConfig(option int) int {
@@ -143,14 +284,6 @@ func sqlVersionNumber() int {
 }
 
 func sqlSourceId() string {
-	// SQLite 3.6.18 introduced sqlite3_sourceid(), see
-	// http://www.hwaci.com/sw/sqlite/changes.html for
-	// details; we can't expect wide availability yet,
-	// for example Debian Lenny ships SQLite 3.5.9 only.
-	if sqlVersionNumber() < 3006018 {
-		return "unknown source id";
-	}
-
 	cp := C.sqlite3_sourceid();
 	if cp == nil {
 		// The call can't really fail since it returns
@@ -200,10 +333,68 @@ func (self *sqlConnection) sqlLastInsertRowId() int64 {
 	return int64(C.sqlite3_last_insert_rowid(self.handle));
 }
 
+func (self *sqlConnection) sqlInterrupt() {
+	C.sqlite3_interrupt(self.handle)
+}
+
+func (self *sqlConnection) sqlGetAutocommit() bool {
+	return C.sqlite3_get_autocommit(self.handle) != 0;
+}
+
 func (self *sqlConnection) sqlBusyTimeout(milliseconds int) int {
 	return int(C.sqlite3_busy_timeout(self.handle, C.int(milliseconds)));
 }
 
+// Install the Go busy handler registered under handle, or
+// remove the busy handler if handle is nil.
+func (self *sqlConnection) sqlBusyHandler(handle unsafe.Pointer) int {
+	return int(C.wsq_busy_handler(self.handle, handle));
+}
+
+// Create a function that calls the Go function registered
+// under handle, see RegisterFunc(). SQLite unregisters the
+// handle once it's done with the function.
+func (self *sqlConnection) sqlCreateFunction(name string, nargs int, flags int, handle unsafe.Pointer) int {
+	p := C.CString(name);
+	rc := int(C.wsq_create_function(self.handle, p, C.int(nargs), C.int(flags), handle));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+// Create an aggregate (or window) function that uses the Go
+// aggregate registered under handle, see RegisterAggregate().
+func (self *sqlConnection) sqlCreateAggregate(name string, nargs int, flags int, handle unsafe.Pointer, window bool) int {
+	p := C.CString(name);
+	w := map[bool]int{true: 1, false: 0}[window];
+	rc := int(C.wsq_create_aggregate(self.handle, p, C.int(nargs), C.int(flags), handle, C.int(w)));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+// Create a collation that calls the Go function registered
+// under handle, see RegisterCollation(). A nil handle removes
+// the collation.
+func (self *sqlConnection) sqlCreateCollation(name string, handle unsafe.Pointer) int {
+	p := C.CString(name);
+	rc := int(C.wsq_create_collation(self.handle, p, handle));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+// Create a module for virtual tables implemented by the Go
+// module registered under handle, see RegisterModule(). An
+// eponymous module can't be used in CREATE VIRTUAL TABLE.
+func (self *sqlConnection) sqlCreateModule(name string, handle unsafe.Pointer, eponymous bool) int {
+	var e C.int;
+	if eponymous {
+		e = 1
+	}
+	p := C.CString(name);
+	rc := int(C.wsq_create_module(self.handle, p, handle, e));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
 func (self *sqlConnection) sqlExtendedResultCodes(on bool) int {
 	v := map[bool]int{true: 1, false: 0}[on];
 	return int(C.sqlite3_extended_result_codes(self.handle, C.int(v)));
@@ -223,28 +414,69 @@ func (self *sqlConnection) sqlErrorCode() int {
 	return int(C.sqlite3_errcode(self.handle));
 }
 
+func (self *sqlConnection) sqlSetAuthorizer(handle unsafe.Pointer) int {
+	return int(C.wsq_set_authorizer(self.handle, handle));
+}
+
+func (self *sqlConnection) sqlProgressHandler(ops int, handle unsafe.Pointer) {
+	C.wsq_progress_handler(self.handle, C.int(ops), handle)
+}
+
+func (self *sqlConnection) sqlTrace(mask int, handle unsafe.Pointer) int {
+	return int(C.wsq_trace(self.handle, C.int(mask), handle));
+}
+
+// Install the update, commit and rollback hooks for the Go hooks
+// registered under handle, or remove them if handle is nil.
+func (self *sqlConnection) sqlSetHooks(handle unsafe.Pointer) {
+	C.wsq_set_hooks(self.handle, handle)
+}
+
+// Constraints on a column of a table. We leave out the declared
+// type and collation, the former we get from the statement and
+// the latter nobody asked for yet.
+func (self *sqlConnection) sqlTableColumnMetadata(database, table, column string) (notNull, primaryKey, autoIncrement bool, rc int) {
+	d := C.CString(database);
+	t := C.CString(table);
+	c := C.CString(column);
+	var nn, pk, ai C.int;
+	rc = int(C.sqlite3_table_column_metadata(self.handle, d, t, c, nil, nil, &nn, &pk, &ai));
+	C.free(unsafe.Pointer(c));
+	C.free(unsafe.Pointer(t));
+	C.free(unsafe.Pointer(d));
+	notNull = nn != 0;
+	primaryKey = pk != 0;
+	autoIncrement = ai != 0;
+	return;
+}
+
+// English description of a status code, for errors that don't
+// leave a message in the connection.
+func sqlErrorString(rc int) string {
+	return C.GoString(C.sqlite3_errstr(C.int(rc)));
+}
+
 func (self *sqlConnection) sqlExtendedErrorCode() int {
-	// SQLite 3.6.5 introduced sqlite3_extended_errcode(),
-	// see http://www.hwaci.com/sw/sqlite/changes.html for
-	// details; we can't expect wide availability yet, for
-	// example Debian Lenny ships SQLite 3.5.9 only.
-	if sqlVersionNumber() < 3006005 {
-		// just return the regular error code...
-		return self.sqlErrorCode();
-	}
 	return int(C.sqlite3_extended_errcode(self.handle));
 }
 
-func (self *sqlConnection) sqlPrepare(query string) (stat *sqlStatement, rc int) {
+// Prepare the first statement in query. The offset of whatever
+// follows that statement is returned in tail, so callers can go
+// through a sequence of statements one at a time. Note that we
+// return a statement with a nil handle if query doesn't contain
+// anything but whitespace and comments.
+func (self *sqlConnection) sqlPrepare(query string) (stat *sqlStatement, tail int, rc int) {
 	stat = new(sqlStatement);
 
 	p := C.CString(query);
-	// TODO: may need tail to process statement sequence? or at
-	// least to generate an error that we missed some SQL?
-	//
+	var t *C.char;
 	// -1: process query until 0 byte
-	// nil: don't return tail pointer
-	rc = int(C.sqlite3_prepare_v2(self.handle, p, -1, &stat.handle, nil));
+	rc = int(C.sqlite3_prepare_v2(self.handle, p, -1, &stat.handle, &t));
+	if t != nil {
+		tail = int(uintptr(unsafe.Pointer(t)) - uintptr(unsafe.Pointer(p)))
+	} else {
+		tail = len(query)
+	}
 	C.free(unsafe.Pointer(p));
 
 	// We are not supposed to get a handle on error. Since
@@ -265,6 +497,21 @@ func (self *sqlStatement) sqlBindParameterCount() int {
 	return int(C.sqlite3_bind_parameter_count(self.handle));
 }
 
+func (self *sqlStatement) sqlBindParameterName(slot int) string {
+	// nil for anonymous "?" parameters, GoString() turns
+	// that into the empty string for us
+	return C.GoString(C.sqlite3_bind_parameter_name(self.handle, C.int(slot+1)));
+}
+
+func (self *sqlStatement) sqlBindParameterIndex(name string) int {
+	p := C.CString(name);
+	// SQLite returns 0 if there's no such parameter, we
+	// return -1 in that case
+	i := int(C.sqlite3_bind_parameter_index(self.handle, p));
+	C.free(unsafe.Pointer(p));
+	return i-1;
+}
+
 func (self *sqlStatement) sqlBindText(slot int, value string) int {
 	p := C.CString(value);
 	// SQLite counts slots from 1 instead of 0; -1 means "until
@@ -274,6 +521,37 @@ func (self *sqlStatement) sqlBindText(slot int, value string) int {
 	return rc;
 }
 
+func (self *sqlStatement) sqlBindBlob(slot int, value []byte) int {
+	if len(value) == 0 {
+		// can't take the address of the first element, but
+		// a zero-length blob is what we want anyway
+		return int(C.sqlite3_bind_zeroblob(self.handle, C.int(slot+1), C.int(0)));
+	}
+	p := unsafe.Pointer(&value[0]);
+	return int(C.wsq_bind_blob(self.handle, C.int(slot+1), p, C.int(len(value))));
+}
+
+func (self *sqlStatement) sqlBindInt64(slot int, value int64) int {
+	return int(C.sqlite3_bind_int64(self.handle, C.int(slot+1), C.sqlite3_int64(value)));
+}
+
+func (self *sqlStatement) sqlBindDouble(slot int, value float64) int {
+	return int(C.sqlite3_bind_double(self.handle, C.int(slot+1), C.double(value)));
+}
+
+func (self *sqlStatement) sqlBindNull(slot int) int {
+	return int(C.sqlite3_bind_null(self.handle, C.int(slot+1)));
+}
+
+// Bind the Go value registered under handle, see wsq_bind_pointer().
+func (self *sqlStatement) sqlBindPointer(slot int, handle unsafe.Pointer) int {
+	return int(C.wsq_bind_pointer(self.handle, C.int(slot+1), handle));
+}
+
+func (self *sqlStatement) sqlReadOnly() bool {
+	return C.sqlite3_stmt_readonly(self.handle) != 0;
+}
+
 func (self *sqlStatement) sqlStep() int {
 	return int(C.sqlite3_step(self.handle));
 }
@@ -329,6 +607,27 @@ func (self *sqlStatement) sqlColumnText(col int) string {
 	return C.GoString(cp);
 }
 
+func (self *sqlStatement) sqlColumnInt64(col int) int64 {
+	return int64(C.sqlite3_column_int64(self.handle, C.int(col)));
+}
+
+func (self *sqlStatement) sqlColumnDouble(col int) float64 {
+	return float64(C.sqlite3_column_double(self.handle, C.int(col)));
+}
+
+func (self *sqlStatement) sqlColumnBlob(col int) []byte {
+	p := C.sqlite3_column_blob(self.handle, C.int(col));
+	// Must ask for the size *after* asking for the blob,
+	// see http://www.sqlite.org/c3ref/column_blob.html for
+	// the gory details on type conversions.
+	n := C.sqlite3_column_bytes(self.handle, C.int(col));
+	if p == nil || n == 0 {
+		// zero-length blobs come back as nil pointers
+		return []byte{};
+	}
+	return C.GoBytes(p, n);
+}
+
 func (self *sqlStatement) sqlColumnDeclaredType(col int) string {
 	cp := C.sqlite3_column_decltype(self.handle, C.int(col));
 	// This can return nil, for example if the column is an
@@ -336,3 +635,249 @@ func (self *sqlStatement) sqlColumnDeclaredType(col int) string {
 	// again no sanity checks...
 	return C.GoString(cp);
 }
+
+// The origin of a result column, see
+// http://www.sqlite.org/c3ref/column_database_name.html; all of
+// these are "" for expressions. SQLite must be compiled with
+// SQLITE_ENABLE_COLUMN_METADATA for them (and for
+// sqlTableColumnMetadata()) to exist.
+
+func (self *sqlStatement) sqlColumnDatabaseName(col int) string {
+	return C.GoString(C.sqlite3_column_database_name(self.handle, C.int(col)));
+}
+
+func (self *sqlStatement) sqlColumnTableName(col int) string {
+	return C.GoString(C.sqlite3_column_table_name(self.handle, C.int(col)));
+}
+
+func (self *sqlStatement) sqlColumnOriginName(col int) string {
+	return C.GoString(C.sqlite3_column_origin_name(self.handle, C.int(col)));
+}
+
+// Wrappers as blob methods.
+
+func (self *sqlConnection) sqlBlobOpen(database, table, column string, row int64, writable bool) (blob *sqlBlob, rc int) {
+	blob = new(sqlBlob);
+
+	d := C.CString(database);
+	t := C.CString(table);
+	c := C.CString(column);
+	w := map[bool]int{true: 1, false: 0}[writable];
+	rc = int(C.sqlite3_blob_open(self.handle, d, t, c, C.sqlite3_int64(row), C.int(w), &blob.handle));
+	C.free(unsafe.Pointer(c));
+	C.free(unsafe.Pointer(t));
+	C.free(unsafe.Pointer(d));
+
+	// unlike sqlite3_open() we're not supposed to get a
+	// handle on error, but better safe than sorry
+	if rc != StatusOk && blob.handle != nil {
+		_ = blob.sqlClose();
+		blob = nil;
+	}
+
+	return;
+}
+
+func (self *sqlBlob) sqlClose() int {
+	return int(C.sqlite3_blob_close(self.handle));
+}
+
+func (self *sqlBlob) sqlBytes() int {
+	return int(C.sqlite3_blob_bytes(self.handle));
+}
+
+func (self *sqlBlob) sqlRead(data []byte, offset int) int {
+	if len(data) == 0 {
+		return StatusOk
+	}
+	p := unsafe.Pointer(&data[0]);
+	return int(C.sqlite3_blob_read(self.handle, p, C.int(len(data)), C.int(offset)));
+}
+
+func (self *sqlBlob) sqlWrite(data []byte, offset int) int {
+	if len(data) == 0 {
+		return StatusOk
+	}
+	p := unsafe.Pointer(&data[0]);
+	return int(C.sqlite3_blob_write(self.handle, p, C.int(len(data)), C.int(offset)));
+}
+
+func (self *sqlBlob) sqlReopen(row int64) int {
+	return int(C.sqlite3_blob_reopen(self.handle, C.sqlite3_int64(row)));
+}
+
+// Wrappers as value methods. We get the values themselves from
+// SQLite when it calls back into Go, see sqlValues().
+
+// Turn the argc/argv pair SQLite hands to callbacks into a slice
+// of values.
+func sqlValues(argc int, argv unsafe.Pointer) (values []sqlValue) {
+	values = make([]sqlValue, argc);
+	if argc == 0 {
+		return
+	}
+	a := (*[1 << 20]*C.sqlite3_value)(argv);
+	for i := 0; i < argc; i++ {
+		values[i].handle = a[i]
+	}
+	return;
+}
+
+func (self *sqlValue) sqlType() int {
+	return int(C.sqlite3_value_type(self.handle));
+}
+
+func (self *sqlValue) sqlInt64() int64 {
+	return int64(C.sqlite3_value_int64(self.handle));
+}
+
+func (self *sqlValue) sqlDouble() float64 {
+	return float64(C.sqlite3_value_double(self.handle));
+}
+
+func (self *sqlValue) sqlText() string {
+	// nil for NULL values, GoString() doesn't mind
+	return C.GoString(C.wsq_value_text(self.handle));
+}
+
+func (self *sqlValue) sqlBlob() []byte {
+	p := C.sqlite3_value_blob(self.handle);
+	// size *after* blob, see sqlColumnBlob()
+	n := C.sqlite3_value_bytes(self.handle);
+	if p == nil || n == 0 {
+		return []byte{};
+	}
+	return C.GoBytes(p, n);
+}
+
+// The handle of a Go value bound with sqlBindPointer(), nil for
+// all other values.
+func (self *sqlValue) sqlPointer() unsafe.Pointer {
+	return C.wsq_value_pointer(self.handle);
+}
+
+// Wrappers as context methods.
+
+func (self *sqlContext) sqlResultNull() {
+	C.sqlite3_result_null(self.handle)
+}
+
+func (self *sqlContext) sqlResultInt64(value int64) {
+	C.sqlite3_result_int64(self.handle, C.sqlite3_int64(value))
+}
+
+func (self *sqlContext) sqlResultDouble(value float64) {
+	C.sqlite3_result_double(self.handle, C.double(value))
+}
+
+func (self *sqlContext) sqlResultText(value string) {
+	p := C.CString(value);
+	C.wsq_result_text(self.handle, p, C.int(-1));
+	C.free(unsafe.Pointer(p));
+}
+
+func (self *sqlContext) sqlResultBlob(value []byte) {
+	if len(value) == 0 {
+		C.sqlite3_result_zeroblob(self.handle, C.int(0));
+		return;
+	}
+	p := unsafe.Pointer(&value[0]);
+	C.wsq_result_blob(self.handle, p, C.int(len(value)));
+}
+
+func (self *sqlContext) sqlResultError(message string) {
+	p := C.CString(message);
+	C.sqlite3_result_error(self.handle, p, C.int(-1));
+	C.free(unsafe.Pointer(p));
+}
+
+// Wrappers as backup methods. Errors from sqlite3_backup_init()
+// end up in the destination connection.
+
+func (self *sqlConnection) sqlBackupInit(destination string, source *sqlConnection, sourceName string) (backup *sqlBackup) {
+	d := C.CString(destination);
+	s := C.CString(sourceName);
+	h := C.sqlite3_backup_init(self.handle, d, source.handle, s);
+	C.free(unsafe.Pointer(s));
+	C.free(unsafe.Pointer(d));
+	if h != nil {
+		backup = &sqlBackup{h}
+	}
+	return;
+}
+
+func (self *sqlBackup) sqlStep(pages int) int {
+	return int(C.sqlite3_backup_step(self.handle, C.int(pages)));
+}
+
+func (self *sqlBackup) sqlRemaining() int {
+	return int(C.sqlite3_backup_remaining(self.handle));
+}
+
+func (self *sqlBackup) sqlPageCount() int {
+	return int(C.sqlite3_backup_pagecount(self.handle));
+}
+
+func (self *sqlBackup) sqlFinish() int {
+	return int(C.sqlite3_backup_finish(self.handle));
+}
+
+// Wrappers as index info methods. SQLite hands us arrays as C
+// pointers, we pretend they're (very large) Go arrays to index
+// them.
+
+func (self *sqlIndexInfo) sqlGet() (info *IndexInfo) {
+	h := self.handle;
+	info = new(IndexInfo);
+
+	n := int(h.nConstraint);
+	info.Constraints = make([]IndexConstraint, n);
+	info.ConstraintUsage = make([]IndexConstraintUsage, n);
+	if n > 0 {
+		a := (*[1 << 16]C.struct_sqlite3_index_constraint)(unsafe.Pointer(h.aConstraint));
+		for i := 0; i < n; i++ {
+			info.Constraints[i] = IndexConstraint{int(a[i].iColumn), int(a[i].op), a[i].usable != 0}
+		}
+	}
+
+	n = int(h.nOrderBy);
+	info.OrderBy = make([]IndexOrderBy, n);
+	if n > 0 {
+		a := (*[1 << 16]C.struct_sqlite3_index_orderby)(unsafe.Pointer(h.aOrderBy));
+		for i := 0; i < n; i++ {
+			info.OrderBy[i] = IndexOrderBy{int(a[i].iColumn), a[i].desc != 0}
+		}
+	}
+
+	info.EstimatedCost = float64(h.estimatedCost);
+	info.EstimatedRows = int64(h.estimatedRows);
+	return;
+}
+
+func (self *sqlIndexInfo) sqlSet(info *IndexInfo) {
+	h := self.handle;
+	b := map[bool]int{true: 1, false: 0};
+
+	n := int(h.nConstraint);
+	if n > len(info.ConstraintUsage) {
+		n = len(info.ConstraintUsage)
+	}
+	if n > 0 {
+		a := (*[1 << 16]C.struct_sqlite3_index_constraint_usage)(unsafe.Pointer(h.aConstraintUsage));
+		for i := 0; i < n; i++ {
+			a[i].argvIndex = C.int(info.ConstraintUsage[i].ArgvIndex);
+			a[i].omit = C.uchar(b[info.ConstraintUsage[i].Omit]);
+		}
+	}
+
+	h.idxNum = C.int(info.IndexNumber);
+	if len(info.IndexString) > 0 {
+		p := C.CString(info.IndexString);
+		h.idxStr = C.wsq_strdup(p);
+		h.needToFreeIdxStr = 1;
+		C.free(unsafe.Pointer(p));
+	}
+	h.orderByConsumed = C.int(b[info.OrderByConsumed]);
+	h.estimatedCost = C.double(info.EstimatedCost);
+	h.estimatedRows = C.sqlite3_int64(info.EstimatedRows);
+}
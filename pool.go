@@ -0,0 +1,322 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// A Pool keeps a number of read-only connections and a single
+// read-write connection to the same database file. Reads can
+// proceed in parallel on the readers (especially with WAL, see
+// http://www.sqlite.org/wal.html) while the writer serializes
+// all changes. This only makes sense for databases in files,
+// every connection to ":memory:" gets a database of its own.
+
+import (
+	"db";
+	"os";
+	"sync";
+	"time";
+)
+
+// Settings for OpenPool(). Times are in nanoseconds.
+type PoolConfig struct {
+	Readers		int;	// maximum number of read-only connections
+	IdleTimeout	int64;	// close readers idle for this long, 0 for never
+	HealthCheck	int64;	// check connections idle for this long before use, 0 for never
+	WAL		bool;	// switch the database to write-ahead logging
+}
+
+// Defaults for OpenPool() if the PoolConfig leaves them out.
+const defaultPoolReaders = 4
+
+type pooled struct {
+	conn	*Connection;
+	used	int64;	// when we last handed it back, in nanoseconds
+}
+
+// SQLite connection pool.
+type Pool struct {
+	name		string;
+	flags		int;
+	vfs		string;
+	timeout		int;
+	config		PoolConfig;
+	lock		sync.Mutex;	// protects idle, writer and closed
+	idle		[]*pooled;	// idle readers, least recently used first
+	readers		chan bool;	// one token per reader in use
+	writer		*pooled;
+	writerLock	sync.Mutex;	// held while the writer is in use
+	closed		bool;
+}
+
+// Create a pool for the database at url (same syntax as for
+// Open()). We open the writer right away to make sure we can,
+// readers are opened as needed.
+func OpenPool(url string, config PoolConfig) (pool *Pool, error os.Error) {
+	p := new(Pool);
+	p.name, p.flags, p.vfs, p.timeout, error = parseConnInfo(url);
+	if error != nil {
+		return
+	}
+
+	if config.Readers <= 0 {
+		config.Readers = defaultPoolReaders
+	}
+	p.config = config;
+	p.readers = make(chan bool, config.Readers);
+
+	var conn *Connection;
+	conn, error = p.openWriter();
+	if error != nil {
+		return
+	}
+	p.writer = &pooled{conn, time.Nanoseconds()};
+
+	pool = p;
+	return;
+}
+
+func (self *Pool) openWriter() (conn *Connection, error os.Error) {
+	flags := self.flags &^ OpenReadOnly | OpenReadWrite;
+	conn, error = openConnection(self.name, flags, self.vfs, self.timeout);
+	if error != nil || !self.config.WAL {
+		return
+	}
+
+	error = conn.exec("PRAGMA journal_mode=WAL");
+	if error != nil {
+		// ignore potential secondary error
+		_ = conn.Close();
+		conn = nil;
+	}
+	return;
+}
+
+func (self *Pool) openReader() (conn *Connection, error os.Error) {
+	flags := self.flags &^ (OpenReadWrite | OpenCreate) | OpenReadOnly;
+	return openConnection(self.name, flags, self.vfs, self.timeout);
+}
+
+// Make sure an idle connection still works, replacing it with
+// a fresh one if it doesn't (or if we don't have one at all).
+func (self *Pool) check(p *pooled, reopen func() (*Connection, os.Error)) (conn *Connection, error os.Error) {
+	if p.conn != nil {
+		if self.config.HealthCheck <= 0 || time.Nanoseconds()-p.used < self.config.HealthCheck {
+			return p.conn, nil
+		}
+		if p.conn.exec("SELECT 1") == nil {
+			return p.conn, nil
+		}
+		// ignore potential secondary error, we're
+		// getting rid of the connection anyway
+		_ = p.conn.Close();
+	}
+	return reopen();
+}
+
+// Close readers that have been idle for too long. Must be
+// called with the lock held.
+func (self *Pool) prune() {
+	if self.config.IdleTimeout <= 0 {
+		return
+	}
+	now := time.Nanoseconds();
+	n := 0;
+	for _, p := range self.idle {
+		if now-p.used < self.config.IdleTimeout {
+			break
+		}
+		// nothing we could do about errors here
+		_ = p.conn.Close();
+		n++;
+	}
+	self.idle = self.idle[n:];
+}
+
+// Get a read-only connection, waiting if all of them are in
+// use. Hand it back with Release() when done.
+func (self *Pool) Reader() (conn *Connection, error os.Error) {
+	self.readers <- true;
+
+	self.lock.Lock();
+	if self.closed {
+		self.lock.Unlock();
+		<-self.readers;
+		error = &DriverError{"Reader: Pool closed!"};
+		return;
+	}
+	self.prune();
+	var p *pooled;
+	if n := len(self.idle); n > 0 {
+		p = self.idle[n-1];
+		self.idle = self.idle[0 : n-1];
+	}
+	self.lock.Unlock();
+
+	if p != nil {
+		conn, error = self.check(p, func() (*Connection, os.Error) { return self.openReader() })
+	} else {
+		conn, error = self.openReader()
+	}
+
+	if error != nil {
+		conn = nil;
+		<-self.readers;
+	}
+	return;
+}
+
+// Get the read-write connection, waiting if it's in use.
+// Hand it back with Release() when done.
+func (self *Pool) Writer() (conn *Connection, error os.Error) {
+	self.writerLock.Lock();
+
+	self.lock.Lock();
+	closed := self.closed;
+	self.lock.Unlock();
+	if closed {
+		self.writerLock.Unlock();
+		error = &DriverError{"Writer: Pool closed!"};
+		return;
+	}
+
+	conn, error = self.check(self.writer, func() (*Connection, os.Error) { return self.openWriter() });
+
+	self.lock.Lock();
+	self.writer.conn = conn;
+	self.lock.Unlock();
+
+	if error != nil {
+		// we'll try again with a fresh connection
+		// next time around
+		conn = nil;
+		self.writerLock.Unlock();
+	}
+	return;
+}
+
+// Roll back a transaction left open on conn. If that fails
+// we close conn instead, nobody should get it in that state.
+func (self *Pool) reset(conn *Connection) (ok bool) {
+	if conn.handle.sqlGetAutocommit() {
+		return true
+	}
+	if conn.exec("ROLLBACK") == nil {
+		return true
+	}
+	// ignore potential secondary error
+	_ = conn.Close();
+	return false;
+}
+
+// Hand back a connection obtained from Reader() or Writer().
+// Any statements prepared on it should be closed already, any
+// transaction still open on it is rolled back.
+func (self *Pool) Release(conn *Connection) {
+	// the connection is still ours, so we don't hold up
+	// everybody else while rolling back
+	ok := self.reset(conn);
+
+	self.lock.Lock();
+	defer self.lock.Unlock();
+
+	if conn == self.writer.conn {
+		// Close() takes care of the writer
+		if !ok {
+			// Writer() opens a fresh one
+			self.writer.conn = nil
+		}
+		self.writer.used = time.Nanoseconds();
+		self.writerLock.Unlock();
+		return;
+	}
+
+	switch {
+	case !ok:
+		// reset() closed it already
+	case self.closed:
+		_ = conn.Close()
+	default:
+		self.idle = append(self.idle, &pooled{conn, time.Nanoseconds()})
+	}
+	<-self.readers;
+}
+
+// Prepare and execute query, returning all results. Read-only
+// queries run on one of the readers, everything else on the
+// writer. Statements that leave a transaction open (BEGIN,
+// SAVEPOINT) fail and are rolled back: the connection goes back
+// to the pool right away, so there's no way to continue the
+// transaction; use Writer() instead.
+func (self *Pool) ExecuteDirectly(query string, parameters ...interface{}) (results [][]interface{}, error os.Error) {
+	var conn *Connection;
+	conn, error = self.Reader();
+	if error != nil {
+		return
+	}
+
+	var s db.Statement;
+	s, error = conn.Prepare(query);
+	if error == nil && !s.(*Statement).ReadOnly() {
+		_ = s.Close();
+		self.Release(conn);
+
+		conn, error = self.Writer();
+		if error != nil {
+			return
+		}
+		s, error = conn.Prepare(query);
+	}
+	defer self.Release(conn);
+	if error != nil {
+		return
+	}
+
+	var rs db.ClassicResultSet;
+	rs, error = conn.ExecuteClassic(s, parameters...);
+	if error == nil {
+		results, error = db.ClassicFetchAll(rs);
+		_ = rs.Close();
+	}
+
+	e := s.Close();
+	if error == nil {
+		error = e
+	}
+	// Release() rolls back for us
+	if error == nil && !conn.handle.sqlGetAutocommit() {
+		results = nil;
+		error = &DriverError{"ExecuteDirectly: Use Writer() for transactions!"};
+	}
+	return;
+}
+
+// Close all idle connections; connections still in use are
+// closed once they are released. Waits for the writer to be
+// released.
+func (self *Pool) Close() (error os.Error) {
+	self.lock.Lock();
+	if self.closed {
+		self.lock.Unlock();
+		return;
+	}
+	self.closed = true;
+
+	for _, p := range self.idle {
+		if e := p.conn.Close(); e != nil && error == nil {
+			error = e
+		}
+	}
+	self.idle = nil;
+	self.lock.Unlock();
+
+	self.writerLock.Lock();
+	if self.writer.conn != nil {
+		if e := self.writer.conn.Close(); e != nil && error == nil {
+			error = e
+		}
+		self.writer.conn = nil;
+	}
+	self.writerLock.Unlock();
+	return;
+}
@@ -7,10 +7,15 @@ package sqlite3
 import "os";
 
 type Result struct {
-	data	[]interface{};
-	error	os.Error;
+	data		[]interface{};
+	error		os.Error;
+	names		[]string;	// column names, see ScanStruct()
+	timeFormat	string;	// for scanning time values
 }
 
 func (self *Result) Data() []interface{}	{ return self.data }
 
 func (self *Result) Error() os.Error	{ return self.error }
+
+// Names of the columns in Data(), in order.
+func (self *Result) Names() []string	{ return self.names }
@@ -0,0 +1,263 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Scanning results into structs. Columns are matched to struct
+// fields by name the same way named parameters are (see tags.go),
+// exactly if possible and ignoring case otherwise, since SQLite
+// doesn't care about case in column names either. Nil pointers to
+// embedded structs are allocated as needed.
+//
+// We're strict about types: a value is only stored in a field if
+// it fits without loss, and NULL only goes into pointer, slice,
+// map and interface fields. Anything else is an error, we never
+// quietly leave a field zero. Values go into fields as follows:
+//
+//	INTEGER	integer types (if in range), float types (if exact), bool (0 or 1)
+//	REAL	float64, float32 (if exact)
+//	TEXT	string, []byte, time.Time (see SetTimeFormat())
+//	BLOB	[]byte
+//	NULL	nil
+//
+// A pointer field gets a pointer to a new value converted like
+// that; an interface{} field gets the value as it is.
+
+import (
+	"db";
+	"fmt";
+	"os";
+	"reflect";
+	"strings";
+	"time";
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Copy the columns of result (as returned by Fetch()) into the
+// fields of the struct dst points to. Columns without a matching
+// field are reported with an UnmatchedColumnsError, but all other
+// fields are filled in anyway.
+func ScanStruct(result db.Result, dst interface{}) (error os.Error) {
+	r, ok := result.(*Result);
+	if !ok {
+		error = &DriverError{"ScanStruct: Not an sqlite3 result!"};
+		return;
+	}
+	if r.error != nil {
+		return r.error
+	}
+
+	v := reflect.ValueOf(dst);
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		error = &DriverError{"ScanStruct: Need a pointer to a struct!"};
+		return;
+	}
+	return r.scan(v.Elem());
+}
+
+// Fetch all remaining results of rs and append them to the slice
+// of structs (or pointers to structs) dst points to. We stop at
+// the first error, except that unmatched columns are reported
+// once all results are in. The result set still needs to be
+// closed as usual.
+func FetchAllInto(rs db.ClassicResultSet, dst interface{}) (error os.Error) {
+	v := reflect.ValueOf(dst);
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		error = &DriverError{"FetchAllInto: Need a pointer to a slice!"};
+		return;
+	}
+
+	s := v.Elem();
+	t := s.Type().Elem();
+	pointers := t.Kind() == reflect.Ptr;
+	if pointers {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		error = &DriverError{"FetchAllInto: Need a slice of structs!"};
+		return;
+	}
+
+	var unmatched os.Error;
+	for rs.More() {
+		p := reflect.New(t);
+		e := ScanStruct(rs.Fetch(), p.Interface());
+		if _, ok := e.(*UnmatchedColumnsError); ok {
+			unmatched = e
+		} else if e != nil {
+			error = e;
+			return;
+		}
+
+		if pointers {
+			s.Set(reflect.Append(s, p))
+		} else {
+			s.Set(reflect.Append(s, p.Elem()))
+		}
+	}
+
+	error = unmatched;
+	return;
+}
+
+func (self *Result) scan(v reflect.Value) (error os.Error) {
+	list := fields(v.Type());
+	var unmatched []string;
+	seen := make(map[string]string);	// field name -> column name
+
+	for i, name := range self.names {
+		f, found := findField(list, name);
+		if !found {
+			unmatched = append(unmatched, name);
+			continue;
+		}
+		if other, ok := seen[f.name]; ok {
+			error = &DriverError{fmt.Sprintf("ScanStruct: Columns %s and %s both go into field %s!", other, name, f.name)};
+			return;
+		}
+		seen[f.name] = name;
+
+		fv, _ := fieldByIndex(v, f.index, true);
+		value := self.data[i];
+		if !self.assign(fv, value) {
+			what := "NULL";
+			if value != nil {
+				what = fmt.Sprintf("%T value", value)
+			}
+			error = &DriverError{fmt.Sprintf("ScanStruct: Can't scan %s of column %s into %s!", what, name, fv.Type())};
+			return;
+		}
+	}
+
+	if unmatched != nil {
+		error = &UnmatchedColumnsError{unmatched}
+	}
+	return;
+}
+
+func findField(list []fieldInfo, name string) (f fieldInfo, found bool) {
+	for _, f = range list {
+		if f.name == name {
+			return f, true
+		}
+	}
+	lower := strings.ToLower(name);
+	for _, f = range list {
+		if strings.ToLower(f.name) == lower {
+			return f, true
+		}
+	}
+	return;
+}
+
+// Store value in f if it fits, see above.
+func (self *Result) assign(f reflect.Value, value interface{}) bool {
+	t := f.Type();
+
+	if value == nil {
+		switch f.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			f.Set(reflect.Zero(t));
+			return true;
+		}
+		return false;
+	}
+
+	switch {
+	case f.Kind() == reflect.Ptr:
+		p := reflect.New(t.Elem());
+		if !self.assign(p.Elem(), value) {
+			return false
+		}
+		f.Set(p);
+		return true;
+	case f.Kind() == reflect.Interface:
+		if t.NumMethod() > 0 {
+			return false
+		}
+		f.Set(reflect.ValueOf(value));
+		return true;
+	case t == timeType:
+		tv, ok := self.timeValue(value);
+		if ok {
+			f.Set(reflect.ValueOf(*tv))
+		}
+		return ok;
+	}
+
+	bytes := f.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8;
+
+	switch v := value.(type) {
+	case int64:
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if !f.OverflowInt(v) {
+				f.SetInt(v);
+				return true;
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v >= 0 && !f.OverflowUint(uint64(v)) {
+				f.SetUint(uint64(v));
+				return true;
+			}
+		case reflect.Float32, reflect.Float64:
+			// only if the value is exact: float64 holds every
+			// integer up to 2^53, float32 needs a round trip
+			if -1<<53 <= v && v <= 1<<53 && (f.Kind() == reflect.Float64 || int64(float32(v)) == v) {
+				f.SetFloat(float64(v));
+				return true;
+			}
+		case reflect.Bool:
+			if v == 0 || v == 1 {
+				f.SetBool(v == 1);
+				return true;
+			}
+		}
+	case float64:
+		switch f.Kind() {
+		case reflect.Float64:
+			f.SetFloat(v);
+			return true;
+		case reflect.Float32:
+			if float64(float32(v)) == v {
+				f.SetFloat(v);
+				return true;
+			}
+		}
+	case string:
+		switch {
+		case f.Kind() == reflect.String:
+			f.SetString(v);
+			return true;
+		case bytes:
+			f.SetBytes([]byte(v));
+			return true;
+		}
+	case []byte:
+		if bytes {
+			f.SetBytes(v);
+			return true;
+		}
+	}
+	return false;
+}
+
+// Turn a value back into a time, the reverse of timeValue() in
+// bind.go.
+func (self *Result) timeValue(value interface{}) (t *time.Time, ok bool) {
+	switch v := value.(type) {
+	case int64:
+		return time.SecondsToUTC(v), true
+	case string:
+		layout := self.timeFormat;
+		if len(layout) == 0 {
+			layout = DefaultTimeFormat
+		}
+		var e os.Error;
+		t, e = time.Parse(layout, v);
+		ok = e == nil;
+	}
+	return;
+}
@@ -0,0 +1,66 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"os";
+	"strings";
+)
+
+// Run a script of SQL statements (such as create_db.sql) one
+// statement at a time. Results, if any, are discarded. We stop
+// at the first statement that fails and return a ScriptError;
+// statements before that one have taken effect already unless
+// the script wraps itself in a transaction.
+func (self *Connection) ExecScript(script string) (error os.Error) {
+	offset := 0;
+
+	for n := 1; offset < len(script); n++ {
+		// skip whitespace so errors point at the statement
+		// itself and not at the end of the previous one
+		offset += len(script[offset:]) - len(strings.TrimLeft(script[offset:], " \t\r\n"));
+		if offset == len(script) {
+			break
+		}
+
+		stat, tail, rc := self.handle.sqlPrepare(script[offset:]);
+		if rc != StatusOk {
+			error = self.scriptError(script, n, offset, self.error());
+			return;
+		}
+
+		if stat.handle != nil {
+			rc = stat.sqlStep();
+			for rc == StatusRow {
+				rc = stat.sqlStep()
+			}
+			self.stepped(rc == StatusDone);
+			if rc != StatusDone {
+				error = self.scriptError(script, n, offset, self.error())
+			}
+			// any error is reported by sqlStep() already
+			_ = stat.sqlFinalize();
+			if error != nil {
+				return
+			}
+		} else {
+			// just a comment or an empty statement
+			n--
+		}
+
+		if tail == 0 {
+			// paranoia: don't loop forever
+			break
+		}
+		offset += tail;
+	}
+
+	return;
+}
+
+func (self *Connection) scriptError(script string, n, offset int, cause os.Error) os.Error {
+	line := 1 + strings.Count(script[0:offset], "\n");
+	return &ScriptError{n, offset, line, cause};
+}
@@ -12,6 +12,8 @@ import (
 type ResultSet struct {
 	// we implement everything in terms of classic stuff
 	classic db.ClassicResultSet;
+	// the same, for column information once classic is gone
+	columns *ClassicResultSet;
 	// channel to send results through
 	results chan db.Result;
 	// channel to check for termination
@@ -20,6 +22,7 @@ type ResultSet struct {
 
 func (self *ResultSet) init(crs db.ClassicResultSet) {
 	self.classic = crs;
+	self.columns = crs.(*ClassicResultSet);
 	self.results = make(chan db.Result);
 	self.stops = make(chan bool);
 }
@@ -62,10 +65,17 @@ func (self *ResultSet) Close() os.Error {
 	return nil;
 }
 
+// Names of the result columns.
 func (self *ResultSet) Names() []string {
-	return nil;
+	return self.columns.Names();
 }
 
+// Declared types of the result columns, "" for expressions.
 func (self *ResultSet) Types() []string {
-	return nil;
+	return self.columns.Types();
+}
+
+// Detailed information about the result columns.
+func (self *ResultSet) Columns() ([]ColumnInfo, os.Error) {
+	return self.columns.Columns();
 }
@@ -10,6 +10,10 @@ import "os";
 type Statement struct {
 	handle		*sqlStatement;
 	connection	*Connection;
+	query		string;	// what we were prepared from, see cache.go
+	generation	int64;	// cache generation we were prepared in
+	results		*ClassicResultSet;	// open results, if any
+	closed		bool;	// Close() waiting for results
 }
 
 // Original query language string.
@@ -17,20 +21,98 @@ func (self *Statement) String() string {
 	return self.handle.sqlSql();
 }
 
+// Names of the statement's parameters in order, including
+// the ":", "@" or "$" prefix. Anonymous "?" parameters have
+// empty names.
+func (self *Statement) Parameters() (names []string) {
+	n := self.handle.sqlBindParameterCount();
+	names = make([]string, n);
+	for i := 0; i < n; i++ {
+		names[i] = self.handle.sqlBindParameterName(i)
+	}
+	return;
+}
+
+// Position (counting from 0) of the parameter with the given
+// name, including its prefix; -1 if there's no such parameter.
+func (self *Statement) ParameterIndex(name string) int {
+	return self.handle.sqlBindParameterIndex(name);
+}
+
+// Does the statement leave the database alone? Note that
+// BEGIN, COMMIT and friends count as read-only as well.
+func (self *Statement) ReadOnly() bool {
+	return self.handle.sqlReadOnly();
+}
+
 // Free all associated resources. After a call to
 // Close() the statement can not be used anymore.
-// If results from the statement are still being
-// processed, bad things will happen.
+// With the statement cache on (see cache.go), the
+// statement is kept for the next Prepare() of the
+// same query instead. If its results are still
+// being processed, Close() returns right away and
+// either happens once they're done; until then the
+// results can still be fetched.
 func (self *Statement) Close() (error os.Error) {
-	rc := self.handle.sqlFinalize();
-	if rc != StatusOk {
-		error = self.connection.error()
+	if self.handle == nil {
+		return
+	}
+	cache := self.connection.cache;
+	cache.lock.Lock();
+	if self.closed {
+		cache.lock.Unlock();
+		return;
+	}
+	if self.results != nil {
+		// see finished()
+		self.closed = true;
+		cache.pending[self] = true;
+		cache.lock.Unlock();
+		return;
+	}
+	cache.lock.Unlock();
+	return self.release();
+}
+
+// Hand the statement back to the cache or finalize it.
+func (self *Statement) release() (error os.Error) {
+	cache := self.connection.cache;
+	if self.clear() != nil || !cache.put(self.query, self.handle, self.generation) {
+		rc := self.handle.sqlFinalize();
+		if rc != StatusOk {
+			error = self.connection.error()
+		}
 	}
 	self.handle = nil;
 	self.connection = nil;
 	return;
 }
 
+// The result set is done, so if we were closed while it was
+// open, we can go back to the cache (or away) now.
+func (self *Statement) finished(rs *ClassicResultSet) {
+	if self.connection == nil {
+		// the connection is closed, see cache.close()
+		return
+	}
+	cache := self.connection.cache;
+	cache.lock.Lock();
+	if self.results != rs {
+		cache.lock.Unlock();
+		return;
+	}
+	self.results = nil;
+	closed := self.closed;
+	if closed {
+		cache.pending[self] = false, false
+	}
+	cache.lock.Unlock();
+
+	if closed {
+		_ = self.release()
+	}
+}
+
 // Make the statement ready for re-binding parameters
 // and re-execution.
 func (self *Statement) clear() (error os.Error) {
@@ -0,0 +1,242 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Inserting and updating rows from structs, the counterpart of
+// ScanStruct(). Fields map to columns as described in tags.go,
+// and these tag options control what we do with them:
+//
+//	omitempty	leave the column out if the field is zero
+//	readonly	never write the column (say it's computed)
+//	key		identifies the row for UpdateStruct()
+//	autoincrement	like key, but if the field is zero when
+//			inserting, SQLite picks the value and we
+//			store it in the field
+//
+// The statements we generate are the same for the same struct
+// type (and the same omitted fields), so they're prepared once and
+// kept in the statement cache, see SetStatementCacheSize().
+
+import (
+	"db";
+	"fmt";
+	"os";
+	"reflect";
+	"strings";
+)
+
+// A column we're about to write.
+type structColumn struct {
+	name	string;
+	value	interface{};
+}
+
+// Insert the struct v points to as a new row of table.
+func InsertStruct(conn *Connection, table string, v interface{}) (error os.Error) {
+	r, error := structValue("InsertStruct", v);
+	if error != nil {
+		return
+	}
+
+	var columns []structColumn;
+	var generated reflect.Value;
+	for _, f := range fields(r.Type()) {
+		if f.has("readonly") {
+			continue
+		}
+		fv, ok := fieldByIndex(r, f.index, false);
+		zero := !ok || isZero(fv);
+		if zero && f.has("autoincrement") {
+			if ok {
+				generated = fv
+			}
+			continue;
+		}
+		if zero && f.has("omitempty") {
+			continue
+		}
+		columns = append(columns, structColumn{f.name, fieldValue(fv, ok)});
+	}
+
+	names := make([]string, len(columns));
+	slots := make([]string, len(columns));
+	values := make([]interface{}, len(columns));
+	for i, c := range columns {
+		names[i] = quoteIdentifier(c.name);
+		slots[i] = "?";
+		values[i] = c.value;
+	}
+
+	query := "INSERT INTO " + quoteIdentifier(table);
+	if len(columns) > 0 {
+		query += " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(slots, ", ") + ")"
+	} else {
+		query += " DEFAULT VALUES"
+	}
+
+	error = conn.execStruct(query, values);
+	if error != nil || !generated.IsValid() {
+		return
+	}
+
+	var id int64;
+	id, error = conn.LastId();
+	if error != nil {
+		return
+	}
+	// the row is in anyway, but we're as strict as ScanStruct()
+	fits := false;
+	switch generated.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if fits = !generated.OverflowInt(id); fits {
+			generated.SetInt(id)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if fits = id >= 0 && !generated.OverflowUint(uint64(id)); fits {
+			generated.SetUint(uint64(id))
+		}
+	}
+	if !fits {
+		error = &DriverError{fmt.Sprintf("InsertStruct: Can't store rowid %d in %s!", id, generated.Type())}
+	}
+	return;
+}
+
+// Update the row of table identified by the given key columns
+// with the struct v points to. Without keyFields, we use the
+// fields tagged key or autoincrement. Fails if no row matches.
+func UpdateStruct(conn *Connection, table string, v interface{}, keyFields ...string) (error os.Error) {
+	r, error := structValue("UpdateStruct", v);
+	if error != nil {
+		return
+	}
+
+	isKey := func(f *fieldInfo) bool {
+		if len(keyFields) == 0 {
+			return f.has("key") || f.has("autoincrement")
+		}
+		for _, k := range keyFields {
+			if k == f.name {
+				return true
+			}
+		}
+		return false;
+	};
+
+	var sets, keys []structColumn;
+	for _, f := range fields(r.Type()) {
+		fv, ok := fieldByIndex(r, f.index, false);
+		if isKey(&f) {
+			keys = append(keys, structColumn{f.name, fieldValue(fv, ok)});
+			continue;
+		}
+		if f.has("readonly") || f.has("omitempty") && (!ok || isZero(fv)) {
+			continue
+		}
+		sets = append(sets, structColumn{f.name, fieldValue(fv, ok)});
+	}
+
+	if len(keyFields) > 0 && len(keys) != len(keyFields) {
+		error = &DriverError{"UpdateStruct: Key field not found!"};
+		return;
+	}
+	if len(keys) == 0 {
+		error = &DriverError{"UpdateStruct: No key fields!"};
+		return;
+	}
+	if len(sets) == 0 {
+		error = &DriverError{"UpdateStruct: Nothing to update!"};
+		return;
+	}
+
+	assignments := make([]string, len(sets));
+	conditions := make([]string, len(keys));
+	values := make([]interface{}, 0, len(sets)+len(keys));
+	for i, c := range sets {
+		assignments[i] = quoteIdentifier(c.name) + " = ?";
+		values = append(values, c.value);
+	}
+	for i, c := range keys {
+		conditions[i] = quoteIdentifier(c.name) + " = ?";
+		values = append(values, c.value);
+	}
+
+	query := "UPDATE " + quoteIdentifier(table) +
+		" SET " + strings.Join(assignments, ", ") +
+		" WHERE " + strings.Join(conditions, " AND ");
+
+	error = conn.execStruct(query, values);
+	if error != nil {
+		return
+	}
+
+	var n int;
+	n, error = conn.Changes();
+	if error == nil && n == 0 {
+		error = &DriverError{"UpdateStruct: No row matched!"}
+	}
+	return;
+}
+
+// The struct v points to.
+func structValue(where string, v interface{}) (r reflect.Value, error os.Error) {
+	r = reflect.ValueOf(v);
+	if r.Kind() != reflect.Ptr || r.IsNil() || r.Elem().Kind() != reflect.Struct {
+		error = &DriverError{where + ": Need a pointer to a struct!"};
+		return;
+	}
+	r = r.Elem();
+	return;
+}
+
+// The value to write for a field, nil if it's missing because of
+// a nil embedded struct pointer.
+func fieldValue(f reflect.Value, ok bool) interface{} {
+	if !ok {
+		return nil
+	}
+	return f.Interface();
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Slice, reflect.Map:
+		return v.IsNil() || v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface());
+}
+
+// Execute a generated statement.
+func (self *Connection) execStruct(query string, values []interface{}) (error os.Error) {
+	var s db.Statement;
+	s, error = self.Prepare(query);
+	if error != nil {
+		return
+	}
+
+	var rs db.ClassicResultSet;
+	rs, error = self.ExecuteClassic(s, values...);
+	if error == nil {
+		error = rs.Close()
+	}
+
+	e := s.Close();
+	if error == nil {
+		error = e
+	}
+	return;
+}
@@ -0,0 +1,189 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Table-valued functions implemented in Go, see
+// http://www.sqlite.org/vtab.html#tabfunc2 for how SQLite treats
+// them. They're eponymous virtual tables whose arguments are
+// hidden columns, so
+//
+//	SELECT * FROM f(1, 2)
+//
+// is just another way of writing
+//
+//	SELECT * FROM f WHERE arg1 = 1 AND arg2 = 2
+//
+// The built-in carray() function turns a Go slice bound to a
+// single parameter with List() into rows, which makes
+//
+//	SELECT * FROM t WHERE id IN carray(?)
+//
+// work for any number of ids without changing the SQL.
+
+import (
+	"os";
+	"strings";
+)
+
+// A table-valued function. The args are the function's arguments
+// in order, nil for those missing in the call. Each row returned
+// must have one value per column.
+type TableFunc func(args []interface{}) (rows [][]interface{}, error os.Error)
+
+// A table-valued function serves as its own module and table.
+type tableFunc struct {
+	columns		[]string;
+	arguments	[]string;
+	fn		TableFunc;
+}
+
+type tableFuncCursor struct {
+	function	*tableFunc;
+	args		[]interface{};
+	rows		[][]interface{};
+	row		int;
+}
+
+// Make fn available as a table-valued function called name. The
+// function's result has the given columns, and it takes as many
+// arguments as there are arguments (named for the hidden columns
+// holding them, which can also be used in the WHERE clause).
+func (self *Connection) RegisterTableFunc(name string, columns []string, arguments []string, fn TableFunc) os.Error {
+	if len(columns) == 0 {
+		return &DriverError{"RegisterTableFunc: No columns!"}
+	}
+	if len(arguments) > 32 {
+		// we keep track of arguments in IndexNumber
+		return &DriverError{"RegisterTableFunc: Too many arguments!"}
+	}
+	return self.createModule(name, &tableFunc{columns, arguments, fn}, true);
+}
+
+func (self *tableFunc) Create(conn *Connection, args []string) (VTab, string, os.Error) {
+	return nil, "", &DriverError{"Create: Table-valued functions can't be created!"}
+}
+
+func (self *tableFunc) Connect(conn *Connection, args []string) (VTab, string, os.Error) {
+	list := make([]string, len(self.columns)+len(self.arguments));
+	for i, c := range self.columns {
+		list[i] = quoteIdentifier(c)
+	}
+	for i, a := range self.arguments {
+		list[len(self.columns)+i] = quoteIdentifier(a) + " HIDDEN"
+	}
+	return self, "CREATE TABLE x(" + strings.Join(list, ", ") + ")", nil;
+}
+
+// Equality constraints on hidden columns are the arguments; we
+// pass them to Filter() in argument order and remember which ones
+// we got in IndexNumber. A plan that needs an argument that isn't
+// available yet gets a cost high enough that SQLite will look for
+// a different one.
+func (self *tableFunc) BestIndex(info *IndexInfo) os.Error {
+	n := len(self.columns);
+	slots := make([]int, len(self.arguments));
+	for a := range slots {
+		slots[a] = -1
+	}
+
+	unusable := false;
+	for i, c := range info.Constraints {
+		a := c.Column - n;
+		if a < 0 || c.Op != IndexConstraintEq {
+			continue
+		}
+		if !c.Usable {
+			unusable = true;
+			continue;
+		}
+		slots[a] = i;
+	}
+
+	k := 1;
+	for a, i := range slots {
+		if i < 0 {
+			continue
+		}
+		info.ConstraintUsage[i] = IndexConstraintUsage{k, true};
+		info.IndexNumber |= 1 << uint(a);
+		k++;
+	}
+
+	if unusable {
+		info.EstimatedCost = 1e99
+	} else {
+		info.EstimatedCost = 1000
+	}
+	return nil;
+}
+
+func (self *tableFunc) Open() (VTabCursor, os.Error) {
+	return &tableFuncCursor{function: self}, nil
+}
+
+func (self *tableFunc) Disconnect() os.Error	{ return nil }
+func (self *tableFunc) Destroy() os.Error	{ return nil }
+
+func (self *tableFuncCursor) Filter(indexNumber int, indexString string, values []interface{}) (error os.Error) {
+	self.args = make([]interface{}, len(self.function.arguments));
+	for a := range self.args {
+		if indexNumber&(1<<uint(a)) != 0 {
+			self.args[a] = values[0];
+			values = values[1:];
+		}
+	}
+	self.row = 0;
+	self.rows, error = self.function.fn(self.args);
+	return;
+}
+
+func (self *tableFuncCursor) Next() os.Error {
+	self.row++;
+	return nil;
+}
+
+func (self *tableFuncCursor) EOF() bool	{ return self.row >= len(self.rows) }
+
+func (self *tableFuncCursor) Column(col int) (value interface{}, error os.Error) {
+	n := len(self.function.columns);
+	if col >= n {
+		value = self.args[col-n];
+		return;
+	}
+	row := self.rows[self.row];
+	if len(row) != n {
+		error = &DriverError{"Column: Table-valued function returned row of wrong length!"};
+		return;
+	}
+	value = row[col];
+	return;
+}
+
+func (self *tableFuncCursor) Rowid() (int64, os.Error)	{ return int64(self.row + 1), nil }
+func (self *tableFuncCursor) Close() os.Error		{ return nil }
+
+// The built-in carray() function, one row per element of a List()
+// bound as its argument.
+func carray(args []interface{}) (rows [][]interface{}, error os.Error) {
+	if args[0] == nil {
+		// carray() or carray(NULL) are empty
+		return
+	}
+	list, ok := args[0].([]interface{});
+	if !ok {
+		error = &DriverError{"carray: Argument must be a List() bound as a parameter!"};
+		return;
+	}
+	rows = make([][]interface{}, len(list));
+	for i, v := range list {
+		rows[i] = []interface{}{v}
+	}
+	return;
+}
+
+// Register carray() on a fresh connection.
+func (self *Connection) registerCarray() os.Error {
+	return self.RegisterTableFunc("carray", []string{"value"}, []string{"pointer"}, carray);
+}
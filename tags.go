@@ -0,0 +1,142 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Mapping struct fields to column (or parameter) names. A field
+// is named by its `db:"name"` tag if it has one, otherwise by the
+// field name itself. Fields tagged `db:"-"` and unexported fields
+// are ignored. Fields of embedded structs are treated as if they
+// were declared in the outer struct, unless the outer struct has
+// a field of the same name already.
+//
+// Options may follow the name, separated by commas, as in
+// `db:"id,key,autoincrement"` or `db:",omitempty"`; see
+// InsertStruct() for what they mean.
+
+import (
+	"reflect";
+	"strings";
+	"sync";
+)
+
+type fieldInfo struct {
+	name	string;	// column or parameter name
+	index	[]int;	// path of field indices, see fieldByIndex()
+	options	[]string;	// from the tag, after the name
+}
+
+func (self *fieldInfo) has(option string) bool {
+	for _, o := range self.options {
+		if o == option {
+			return true
+		}
+	}
+	return false;
+}
+
+var fieldCache = make(map[reflect.Type][]fieldInfo)
+var fieldLock sync.Mutex
+
+// Split a tag into the name and the options following it.
+func parseTag(tag string) (name string, options []string) {
+	parts := strings.Split(tag, ",");
+	name = parts[0];
+	options = parts[1:];
+	return;
+}
+
+// The fields of a struct type, computed once and cached.
+func fields(t reflect.Type) []fieldInfo {
+	fieldLock.Lock();
+	defer fieldLock.Unlock();
+
+	f, ok := fieldCache[t];
+	if !ok {
+		f = appendFields(nil, t, nil);
+		fieldCache[t] = f;
+	}
+	return f;
+}
+
+func appendFields(list []fieldInfo, t reflect.Type, index []int) []fieldInfo {
+	var embedded []int;
+	start := len(list);
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i);
+		name, options := parseTag(f.Tag.Get("db"));
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && len(name) == 0 {
+			// come back for these once we know the
+			// names declared directly in this struct
+			embedded = append(embedded, i);
+			continue;
+		}
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		list = append(list, fieldInfo{name, extendIndex(index, i), options});
+	}
+
+	for _, i := range embedded {
+		ft := t.Field(i).Type;
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct {
+			continue
+		}
+		inner := appendFields(nil, ft, extendIndex(index, i));
+		for _, f := range inner {
+			if !hasField(list[start:], f.name) {
+				list = append(list, f)
+			}
+		}
+	}
+
+	return list;
+}
+
+func extendIndex(index []int, i int) []int {
+	r := make([]int, len(index)+1);
+	copy(r, index);
+	r[len(index)] = i;
+	return r;
+}
+
+func hasField(list []fieldInfo, name string) bool {
+	for _, f := range list {
+		if f.name == name {
+			return true
+		}
+	}
+	return false;
+}
+
+// Walk the path of field indices starting at struct value v. If
+// we run into a nil pointer to an embedded struct, we allocate it
+// if alloc is set and give up (returning !ok) otherwise.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (f reflect.Value, ok bool) {
+	f = v;
+	for i, x := range index {
+		if i > 0 && f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				if !alloc {
+					return
+				}
+				f.Set(reflect.New(f.Type().Elem()));
+			}
+			f = f.Elem();
+		}
+		f = f.Field(x);
+	}
+	ok = true;
+	return;
+}
@@ -0,0 +1,63 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Tracing and profiling, see http://www.sqlite.org/c3ref/trace_v2.html
+// for details.
+
+import (
+	"os";
+	"unsafe";
+)
+
+// A statement starts running. SQL is the text it was prepared
+// from (or "-- name" for a trigger starting), Expanded the same
+// with bound parameters filled in.
+type StmtEvent struct {
+	SQL		string;
+	Expanded	string;
+}
+
+// A statement is done running, having taken the given time.
+type ProfileEvent struct {
+	SQL		string;
+	Expanded	string;
+	Nanoseconds	int64;
+}
+
+// A statement produced a row.
+type RowEvent struct {
+	SQL string;
+}
+
+// The connection is closing.
+type CloseEvent struct{}
+
+// Called for trace events, with one of *StmtEvent, *ProfileEvent,
+// *RowEvent or *CloseEvent. Like a BusyHandler, a Tracer must not
+// use the connection.
+type Tracer func(event interface{})
+
+// Call tracer for the kinds of events in mask (TraceStmt and
+// friends or'd together), replacing the previous tracer. A nil
+// tracer or an empty mask stops tracing.
+func (self *Connection) Trace(mask int, tracer Tracer) (error os.Error) {
+	var handle unsafe.Pointer;
+	if tracer != nil && mask != 0 {
+		handle = register(tracer)
+	}
+
+	rc := self.handle.sqlTrace(mask, handle);
+	if rc != StatusOk {
+		error = self.error();
+		if handle != nil {
+			unregister(handle)
+		}
+		return;
+	}
+
+	self.setCallback("trace", handle);
+	return;
+}
@@ -0,0 +1,245 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"db";
+	"fmt";
+	"os";
+)
+
+// Transaction modes for Begin(). See the SQLite docs at
+// http://www.sqlite.org/lang_transaction.html for details
+// on locking.
+const (
+	TxDeferred	= iota;	// acquire locks on first access
+	TxImmediate;		// acquire RESERVED lock right away
+	TxExclusive;		// acquire EXCLUSIVE lock right away
+)
+
+var txBegin = []string{"BEGIN DEFERRED", "BEGIN IMMEDIATE", "BEGIN EXCLUSIVE"}
+
+// SQLite transactions. A Tx is finished once it has been
+// committed or rolled back; after that it refuses to do
+// anything else. Nested transactions created with Savepoint()
+// are Tx values as well, and are finished along with their
+// parent.
+type Tx struct {
+	connection	*Connection;
+	done		bool;
+	parent		*Tx;	// nil unless this is a savepoint
+	name		string;	// savepoint name, quoted
+	depth		int;	// number of parents
+	mark		int;	// pending changes when the savepoint started, see hooks.go
+}
+
+// Run a statement for its side effects only. We go through the
+// regular Prepare() and ExecuteClassic() paths on purpose.
+func (self *Connection) exec(query string) (error os.Error) {
+	var s db.Statement;
+	s, error = self.Prepare(query);
+	if error != nil {
+		return
+	}
+
+	var rs db.ClassicResultSet;
+	rs, error = self.ExecuteClassic(s);
+	if error == nil {
+		_ = rs.Close()
+	}
+
+	e := s.Close();
+	if error == nil {
+		error = e
+	}
+	return;
+}
+
+// Start a transaction in the given mode.
+func (self *Connection) Begin(mode int) (tx *Tx, error os.Error) {
+	if mode < TxDeferred || mode > TxExclusive {
+		error = &DriverError{"Begin: Unknown transaction mode!"};
+		return;
+	}
+
+	error = self.exec(txBegin[mode]);
+	if error != nil {
+		return
+	}
+
+	tx = new(Tx);
+	tx.connection = self;
+	return;
+}
+
+// Run body inside a transaction. If body returns an error or
+// panics, the transaction is rolled back (and the panic goes
+// on); otherwise it is committed. If body finishes the
+// transaction itself, we leave it alone.
+func (self *Connection) Transaction(mode int, body func(*Tx) os.Error) (error os.Error) {
+	var tx *Tx;
+	tx, error = self.Begin(mode);
+	if error != nil {
+		return
+	}
+	return tx.run(body);
+}
+
+func (self *Tx) run(body func(*Tx) os.Error) (error os.Error) {
+	defer func() {
+		if x := recover(); x != nil {
+			// ignore secondary error, the panic is
+			// more important
+			_ = self.Rollback();
+			panic(x);
+		}
+	}();
+
+	error = body(self);
+	if self.done {
+		return
+	}
+
+	if error == nil {
+		error = self.Commit()
+	}
+	if error != nil {
+		// ignore secondary error, we report the
+		// one that made us roll back
+		_ = self.Rollback()
+	}
+	return;
+}
+
+func (self *Tx) check(where string) (error os.Error) {
+	for t := self; t != nil; t = t.parent {
+		if t.done {
+			error = &DriverError{where + ": Transaction already finished!"};
+			return;
+		}
+	}
+	return;
+}
+
+// Start a nested transaction using SAVEPOINT. The result is a
+// Tx whose Commit() releases the savepoint and whose Rollback()
+// undoes changes back to the savepoint, leaving this Tx alone.
+// If name is empty we make one up.
+func (self *Tx) Savepoint(name string) (tx *Tx, error os.Error) {
+	error = self.check("Savepoint");
+	if error != nil {
+		return
+	}
+
+	if len(name) == 0 {
+		name = fmt.Sprintf("sqlite3_savepoint_%d", self.depth+1)
+	}
+	name = quoteIdentifier(name);
+
+	mark := self.connection.changeMark();
+	error = self.connection.exec("SAVEPOINT " + name);
+	if error != nil {
+		return
+	}
+
+	tx = new(Tx);
+	tx.connection = self.connection;
+	tx.parent = self;
+	tx.name = name;
+	tx.depth = self.depth + 1;
+	tx.mark = mark;
+	return;
+}
+
+// Run body inside a nested transaction, see Savepoint() and
+// Connection.Transaction() for details.
+func (self *Tx) Transaction(name string, body func(*Tx) os.Error) (error os.Error) {
+	var tx *Tx;
+	tx, error = self.Savepoint(name);
+	if error != nil {
+		return
+	}
+	return tx.run(body);
+}
+
+// Precompile query into Statement, see Connection.Prepare().
+func (self *Tx) Prepare(query string) (statement db.Statement, error os.Error) {
+	error = self.check("Prepare");
+	if error != nil {
+		return
+	}
+	return self.connection.Prepare(query);
+}
+
+// Execute statement with parameters, see Connection.Execute().
+func (self *Tx) Execute(statement db.Statement, parameters ...interface{}) (rs db.ResultSet, error os.Error) {
+	error = self.check("Execute");
+	if error != nil {
+		return
+	}
+	return self.connection.Execute(statement, parameters...);
+}
+
+// Execute statement with parameters, see Connection.ExecuteClassic().
+func (self *Tx) ExecuteClassic(statement db.Statement, parameters ...interface{}) (rs db.ClassicResultSet, error os.Error) {
+	error = self.check("Execute");
+	if error != nil {
+		return
+	}
+	return self.connection.ExecuteClassic(statement, parameters...);
+}
+
+// Make the transaction's changes permanent (or, for a savepoint,
+// part of its parent). If this fails, the transaction is still
+// active and can be rolled back.
+func (self *Tx) Commit() (error os.Error) {
+	error = self.check("Commit");
+	if error != nil {
+		return
+	}
+
+	if self.parent != nil {
+		error = self.connection.exec("RELEASE " + self.name)
+	} else {
+		error = self.connection.exec("COMMIT")
+	}
+	if error == nil {
+		self.done = true
+	}
+	return;
+}
+
+// Undo the transaction's changes. If this fails, the transaction
+// is still active and Rollback() can be tried again.
+func (self *Tx) Rollback() (error os.Error) {
+	error = self.check("Rollback");
+	if error != nil {
+		return
+	}
+
+	// Some errors make SQLite roll back on its own, see
+	// http://www.sqlite.org/lang_transaction.html; if so
+	// there's nothing left for us to do.
+	if self.connection.handle.sqlGetAutocommit() {
+		self.done = true;
+		return;
+	}
+
+	if self.parent == nil {
+		error = self.connection.exec("ROLLBACK")
+	} else {
+		// ROLLBACK TO leaves the savepoint on the stack, so
+		// we have to release it as well
+		error = self.connection.exec("ROLLBACK TO " + self.name);
+		if error == nil {
+			self.connection.dropChanges(self.mark);
+			error = self.connection.exec("RELEASE " + self.name);
+		}
+	}
+	if error == nil {
+		self.done = true
+	}
+	return;
+}
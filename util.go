@@ -4,7 +4,10 @@
 
 package sqlite3
 
-import "fmt"
+import (
+	"fmt";
+	"strings";
+)
 
 // FlagsURL() is a helper to turn the various OpenXYZ option
 // flags into the "flags=123456789" notation required for
@@ -12,3 +15,17 @@ import "fmt"
 // go from int to string and back to int, but thus is the
 // price of generality.
 func FlagsURL(options int) string	{ return fmt.Sprintf("flags=%d", options) }
+
+// BusyTimeoutURL() is a helper to turn a timeout in milliseconds
+// into the "busy_timeout=123" notation for the URL passed to
+// Open(). The default is 16 seconds, 0 means we give up as soon
+// as we find the database locked. See also SetBusyTimeout().
+func BusyTimeoutURL(milliseconds int) string {
+	return fmt.Sprintf("busy_timeout=%d", milliseconds)
+}
+
+// Quote an identifier (table, column, savepoint, ...) so it's
+// safe to paste into SQL.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
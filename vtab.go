@@ -0,0 +1,228 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Virtual tables implemented in Go, see http://www.sqlite.org/vtab.html
+// for how they work. A Module registered with RegisterModule() can
+// be used in CREATE VIRTUAL TABLE statements; the resulting tables
+// are queried (and, if they implement VTabUpdater, changed) just
+// like any other table.
+//
+// SQLite only ever sees registry handles for modules, tables and
+// cursors, never Go pointers, see callback.go. Tables and cursors
+// are unregistered when SQLite disconnects or closes them, modules
+// when the connection is closed.
+
+import (
+	"fmt";
+	"os";
+)
+
+// A virtual table module.
+type Module interface {
+	// Called for CREATE VIRTUAL TABLE. The args are the module
+	// name, the database name, the table name and the arguments
+	// from the CREATE VIRTUAL TABLE statement, if any. Returns
+	// the table and a CREATE TABLE statement declaring columns.
+	Create(conn *Connection, args []string) (table VTab, schema string, error os.Error);
+	// Called for existing tables, otherwise like Create().
+	Connect(conn *Connection, args []string) (table VTab, schema string, error os.Error);
+}
+
+// A virtual table.
+type VTab interface {
+	// Pick a query plan, see IndexInfo.
+	BestIndex(info *IndexInfo) os.Error;
+	// Start a scan over the table.
+	Open() (VTabCursor, os.Error);
+	// Called when the connection lets go of the table.
+	Disconnect() os.Error;
+	// Called for DROP TABLE, should destroy the data as well.
+	Destroy() os.Error;
+}
+
+// A virtual table that can be changed. Without this, INSERT,
+// UPDATE and DELETE on the table fail.
+type VTabUpdater interface {
+	// Insert a row with the given column values. The rowid is
+	// nil if the table should pick one, int64 otherwise. Returns
+	// the rowid of the new row.
+	Insert(rowid interface{}, values []interface{}) (int64, os.Error);
+	// Replace the row oldRowid with a row newRowid (often the
+	// same) having the given column values.
+	Update(oldRowid, newRowid int64, values []interface{}) os.Error;
+	// Delete the row.
+	Delete(rowid int64) os.Error;
+}
+
+// A scan over a virtual table.
+type VTabCursor interface {
+	// Start over with the plan picked by BestIndex(); args has
+	// the values of the constraints that got an ArgvIndex.
+	Filter(indexNumber int, indexString string, args []interface{}) os.Error;
+	// Move to the next row.
+	Next() os.Error;
+	// Are we past the last row?
+	EOF() bool;
+	// Value of a column in the current row, counting from 0.
+	Column(col int) (interface{}, os.Error);
+	// Rowid of the current row.
+	Rowid() (int64, os.Error);
+	// Called when the scan is done.
+	Close() os.Error;
+}
+
+// A constraint of the form "column op value" from the WHERE
+// clause. Usable is false if the value isn't available yet,
+// for example because it depends on a later table in a join.
+type IndexConstraint struct {
+	Column	int;	// -1 for the rowid
+	Op	int;	// IndexConstraintEq and friends
+	Usable	bool;
+}
+
+// A term from the ORDER BY clause.
+type IndexOrderBy struct {
+	Column	int;
+	Desc	bool;
+}
+
+// What BestIndex() does with a constraint. If ArgvIndex is
+// positive, the constraint's value is passed to Filter() in
+// args[ArgvIndex-1]. If Omit is set, SQLite trusts the table
+// to check the constraint and doesn't double-check.
+type IndexConstraintUsage struct {
+	ArgvIndex	int;
+	Omit		bool;
+}
+
+// Input and output for VTab.BestIndex(). The table looks at the
+// Constraints and OrderBy, and fills in the rest. IndexNumber
+// and IndexString are passed on to Filter() unchanged.
+type IndexInfo struct {
+	Constraints	[]IndexConstraint;
+	OrderBy		[]IndexOrderBy;
+
+	ConstraintUsage	[]IndexConstraintUsage;	// one per constraint
+	IndexNumber	int;
+	IndexString	string;
+	OrderByConsumed	bool;	// rows come out in ORDER BY order
+	EstimatedCost	float64;
+	EstimatedRows	int64;
+}
+
+// Registry entries for modules, tables and cursors.
+
+type module struct {
+	connection	*Connection;
+	impl		Module;
+}
+
+type vtable struct {
+	connection	*Connection;
+	impl		VTab;
+}
+
+type vcursor struct {
+	connection	*Connection;
+	impl		VTabCursor;
+}
+
+// Make m available for CREATE VIRTUAL TABLE ... USING name.
+func (self *Connection) RegisterModule(name string, m Module) os.Error {
+	return self.createModule(name, m, false)
+}
+
+func (self *Connection) createModule(name string, m Module, eponymous bool) (error os.Error) {
+	mod := &module{self, m};
+	handle := register(mod);
+	rc := self.handle.sqlCreateModule(name, handle, eponymous);
+	if rc != StatusOk {
+		error = self.error();
+		// unregistering twice doesn't hurt, so we don't
+		// care if SQLite did it already
+		unregister(handle);
+	}
+	return;
+}
+
+// Create or connect to a table.
+func (self *module) init(args []string, create bool) (table *vtable, schema string, error os.Error) {
+	var t VTab;
+	if create {
+		t, schema, error = self.impl.Create(self.connection, args)
+	} else {
+		t, schema, error = self.impl.Connect(self.connection, args)
+	}
+	if error != nil {
+		return
+	}
+	table = &vtable{self.connection, t};
+	return;
+}
+
+func (self *vtable) open() (cursor *vcursor, error os.Error) {
+	var c VTabCursor;
+	c, error = self.impl.Open();
+	if error != nil {
+		return
+	}
+	cursor = &vcursor{self.connection, c};
+	return;
+}
+
+// Decode the arguments SQLite passes to xUpdate, see
+// http://www.sqlite.org/vtab.html#xupdate for the gory details.
+func (self *vtable) update(values []sqlValue) (rowid int64, error os.Error) {
+	u, ok := self.impl.(VTabUpdater);
+	if !ok {
+		error = &DriverError{"Update: Virtual table is read-only!"};
+		return;
+	}
+
+	if len(values) == 1 {
+		error = u.Delete(values[0].sqlInt64());
+		return;
+	}
+
+	columns := make([]interface{}, len(values)-2);
+	for i := range columns {
+		columns[i] = values[i+2].value()
+	}
+
+	if values[0].sqlType() == sqlNullType {
+		return u.Insert(values[1].value(), columns)
+	}
+
+	rowid = values[1].sqlInt64();
+	error = u.Update(values[0].sqlInt64(), rowid, columns);
+	return;
+}
+
+func (self *vcursor) filter(indexNumber int, indexString string, values []sqlValue) os.Error {
+	args := make([]interface{}, len(values));
+	for i := range values {
+		args[i] = values[i].value()
+	}
+	return self.impl.Filter(indexNumber, indexString, args);
+}
+
+func (self *vcursor) column(ctx *sqlContext, col int) (error os.Error) {
+	var value interface{};
+	value, error = self.impl.Column(col);
+	if error != nil {
+		return
+	}
+	ctx.result(self.connection, value);
+	return;
+}
+
+// Turn whatever went wrong in a Go callback into an error.
+func callbackError(x interface{}) os.Error {
+	if e, ok := x.(os.Error); ok {
+		return e
+	}
+	return &DriverError{fmt.Sprintf("panic: %v", x)};
+}